@@ -5,5 +5,8 @@ go 1.12
 require (
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/sirupsen/logrus v1.4.2
+	golang.org/x/crypto v0.27.0
 	golang.org/x/net v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.7.3
 )
@@ -0,0 +1,280 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	ApiKeyInHeader       = "header"
+	ApiKeyInQuery        = "query"
+	DefaultApiKeyHeader  = "X-API-Key"
+	DefaultApiKeyQuery   = "api_key"
+	RedactedSecret       = "********"
+	AuthorizationHeader  = "Authorization"
+	BearerAuthorization  = "Bearer "
+	minRedactedSecretLen = 4
+)
+
+// ValidateAuthTokens checks the bearer token and api key settings. The
+// token is read from auth_bearer_file when auth_bearer is not set.
+func (p *Plugin) ValidateAuthTokens() error {
+
+	if p.AuthBearer != "" && p.AuthBearerFile != "" {
+		return errors.New("auth_bearer and auth_bearer_file cannot both be set")
+	}
+
+	p.bearerToken = strings.TrimSpace(p.AuthBearer)
+
+	if p.AuthBearerFile != "" {
+		token, err := os.ReadFile(p.AuthBearerFile)
+		if err != nil {
+			return errors.New("cannot read auth_bearer_file: " + err.Error())
+		}
+		p.bearerToken = strings.TrimSpace(string(token))
+		if p.bearerToken == "" {
+			return errors.New("auth_bearer_file " + p.AuthBearerFile + " is empty")
+		}
+	}
+
+	if p.bearerToken != "" && p.IsAuthBasic() {
+		return errors.New("auth_basic and auth_bearer cannot both be set")
+	}
+
+	switch strings.ToLower(p.ApiKeyIn) {
+	case "", ApiKeyInHeader, ApiKeyInQuery:
+	default:
+		return errors.New("invalid api_key_in " + p.ApiKeyIn + ", expected header or query")
+	}
+
+	return nil
+}
+
+// SetAuthTokens adds the bearer token and the api key to the request.
+func (p *Plugin) SetAuthTokens() error {
+
+	if p.bearerToken == "" && p.ApiKey == "" {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetAuthTokens http request is nil")
+	}
+
+	if p.bearerToken != "" {
+		p.HttpReq.Header.Set(AuthorizationHeader, BearerAuthorization+p.bearerToken)
+	}
+
+	if p.ApiKey == "" {
+		return nil
+	}
+
+	if strings.ToLower(p.ApiKeyIn) == ApiKeyInQuery {
+		name := p.ApiKeyName
+		if name == "" {
+			name = DefaultApiKeyQuery
+		}
+		query := p.HttpReq.URL.Query()
+		query.Set(name, p.ApiKey)
+		p.HttpReq.URL.RawQuery = query.Encode()
+		return nil
+	}
+
+	name := p.ApiKeyName
+	if name == "" {
+		name = DefaultApiKeyHeader
+	}
+	p.HttpReq.Header.Set(name, p.ApiKey)
+
+	return nil
+}
+
+// AnswerAuthChallenge prepares the answer to the challenge of a 401
+// response and reports whether the request should be sent again.
+func (p *Plugin) AnswerAuthChallenge(resp *http.Response) (bool, error) {
+
+	switch {
+	case p.IsOAuth2() && !p.oauth2Refreshed:
+		p.oauth2Refreshed = true
+		LogPrintln(p, "oauth2 access token rejected, fetching a new one")
+		return true, p.FetchOAuth2Token()
+
+	case p.digestCredentials != nil:
+		return p.AnswerDigestChallenge(resp)
+
+	case p.ntlmCredentials != nil:
+		return p.AnswerNtlmChallenge(resp)
+	}
+
+	return false, nil
+}
+
+// Secrets returns the credentials of the plugin that must never show
+// up in the logs.
+func (p *Plugin) Secrets() []string {
+
+	var secrets []string
+
+	candidates := []string{p.AuthPass, p.AuthBearer, p.bearerToken, p.ApiKey, p.OAuth2ClientSecret, p.oauth2Token, p.HmacSecret, p.jwtToken,
+		p.ClientKeyPassword, p.ClientPkcs12Password, p.ProxyPassword, proxyUrlPassword(p.Proxy)}
+	if p.digestCredentials != nil {
+		candidates = append(candidates, p.digestCredentials.Pass)
+	}
+	if p.ntlmCredentials != nil {
+		candidates = append(candidates, p.ntlmCredentials.Pass)
+	}
+	if p.awsCredentials != nil {
+		candidates = append(candidates, p.awsCredentials.SecretAccessKey, p.awsCredentials.SessionToken)
+	}
+
+	for _, secret := range candidates {
+		if len(secret) >= minRedactedSecretLen {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets
+}
+
+// RedactSecrets masks the credentials of the plugin in text, including
+// their query escaped form as they appear in urls.
+func (p *Plugin) RedactSecrets(text string) string {
+
+	if p == nil {
+		return text
+	}
+
+	for _, secret := range p.Secrets() {
+		text = strings.Replace(text, secret, RedactedSecret, -1)
+		text = strings.Replace(text, url.QueryEscape(secret), RedactedSecret, -1)
+	}
+
+	return text
+}
+
+// RedactError returns err with the credentials masked, err itself is
+// returned when it does not contain any.
+func (p *Plugin) RedactError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	redacted := p.RedactSecrets(err.Error())
+	if redacted == err.Error() {
+		return err
+	}
+
+	return errors.New(redacted)
+}
+
+// AuthChallenge is one challenge of a WWW-Authenticate header, with
+// either a token, as NTLM sends it, or auth params.
+type AuthChallenge struct {
+	Scheme string
+	Token  string
+	Params map[string]string
+}
+
+// ParseAuthChallenges parses the WWW-Authenticate headers of a
+// response, a header may carry several comma separated challenges.
+func ParseAuthChallenges(values []string) []AuthChallenge {
+
+	var challenges []AuthChallenge
+
+	for _, value := range values {
+		s := value
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			token, rest := readAuthToken(s)
+			if token == "" {
+				break
+			}
+			rest = strings.TrimLeft(rest, " \t")
+
+			if strings.HasPrefix(rest, "=") && len(challenges) > 0 {
+				var paramValue string
+				paramValue, s = readAuthParamValue(strings.TrimLeft(rest[1:], " \t"))
+				challenges[len(challenges)-1].Params[strings.ToLower(token)] = paramValue
+				continue
+			}
+
+			challenge := AuthChallenge{Scheme: token, Params: map[string]string{}}
+			challenge.Token, s = readAuthToken68(rest)
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return challenges
+}
+
+func isAuthTokenChar(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func readAuthToken(s string) (string, string) {
+	i := 0
+	for i < len(s) && isAuthTokenChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// readAuthToken68 reads a token68 that ends the challenge, it leaves s
+// alone when s starts with an auth param instead.
+func readAuthToken68(s string) (string, string) {
+	i := 0
+	for i < len(s) && ('A' <= s[i] && s[i] <= 'Z' || 'a' <= s[i] && s[i] <= 'z' ||
+		'0' <= s[i] && s[i] <= '9' || strings.IndexByte("-._~+/", s[i]) >= 0) {
+		i++
+	}
+	if i == 0 {
+		return "", s
+	}
+	for i < len(s) && s[i] == '=' {
+		i++
+	}
+	rest := strings.TrimLeft(s[i:], " \t")
+	if rest != "" && rest[0] != ',' {
+		return "", s
+	}
+	return s[:i], rest
+}
+
+func readAuthParamValue(s string) (string, string) {
+
+	if !strings.HasPrefix(s, `"`) {
+		return readAuthToken(s)
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return value.String(), ""
+}
+
+func quoteAuthParam(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return `"` + value + `"`
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthBasicWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestAuthBasicWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestAuthBasicWithLocalServer test")
+	}
+
+	var received []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received = append(received, user+" "+pass)
+	}))
+	defer ts.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("fr0m:f1le\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	valid := []PluginInputParams{
+		{AuthBasic: "vault:gen:er:ated"},
+		{AuthBasicUsername: "deploy", AuthBasicPassword: "a:b"},
+		{AuthBasicUsername: "deploy", AuthBasicPasswordFile: passwordFile},
+		{AuthBasic: "token:", AuthBasicAllowEmptyPassword: true},
+	}
+
+	for _, params := range valid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err != nil {
+			t.Errorf("Exec() with %+v returned an error: %v", params, err)
+		}
+	}
+
+	expected := []string{"vault gen:er:ated", "deploy a:b", "deploy fr0m:f1le", "token "}
+	if strings.Join(received, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected credentials %q, got %q", expected, received)
+	}
+
+	invalid := []PluginInputParams{
+		{AuthBasic: "no-colon"},
+		{AuthBasic: "token:"},
+		{AuthBasic: ":pass"},
+		{AuthBasicUsername: "deploy"},
+		{AuthBasic: "user:pass", AuthBasicUsername: "deploy"},
+		{AuthBasicPassword: "pass"},
+		{AuthBasicUsername: "deploy", AuthBasicPassword: "a", AuthBasicPasswordFile: passwordFile},
+		{AuthBasicUsername: "deploy", AuthBasicPasswordFile: filepath.Join(t.TempDir(), "missing")},
+	}
+
+	for _, params := range invalid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		err := Exec(context.Background(), Args{PluginInputParams: params})
+		if err == nil || !strings.Contains(err.Error(), "auth_basic info not good") {
+			t.Errorf("Expected %+v to be rejected, got %v", params, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthTokensWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestAuthTokensWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestAuthTokensWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bearer":
+			if r.Header.Get("Authorization") != "Bearer s3cr3t-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		case "/header":
+			if r.Header.Get("X-Custom-Key") != "k3y-value" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		case "/query":
+			if r.URL.Query().Get("key") != "k3y value" || r.URL.Query().Get("page") != "2" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cr3t-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		params PluginInputParams
+	}{
+		{"bearer", PluginInputParams{Url: ts.URL + "/bearer", AuthBearer: "s3cr3t-token"}},
+		{"bearer file", PluginInputParams{Url: ts.URL + "/bearer", AuthBearerFile: tokenFile}},
+		{"api key header", PluginInputParams{Url: ts.URL + "/header", ApiKey: "k3y-value", ApiKeyName: "X-Custom-Key"}},
+		{"api key query", PluginInputParams{Url: ts.URL + "/query?page=2", ApiKey: "k3y value", ApiKeyIn: "query", ApiKeyName: "key"}},
+	}
+
+	for _, tc := range tests {
+		tc.params.HttpMethod = "GET"
+		tc.params.Quiet = true
+		err := Exec(context.Background(), Args{PluginInputParams: tc.params})
+		if err != nil {
+			t.Errorf("%s: Exec() returned an error: %v", tc.name, err)
+		}
+	}
+
+	invalid := []PluginInputParams{
+		{Url: ts.URL, AuthBearer: "a", AuthBearerFile: tokenFile},
+		{Url: ts.URL, AuthBearer: "a", AuthBasic: "user:pass"},
+		{Url: ts.URL, ApiKey: "a", ApiKeyIn: "cookie"},
+		{Url: ts.URL, AuthBearerFile: filepath.Join(t.TempDir(), "missing")},
+	}
+
+	for _, params := range invalid {
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
+
+func TestAuthTokenRedaction(t *testing.T) {
+
+	_, found := enableTests["TestAuthTokenRedaction"]
+	if !found {
+		t.Skip("Skipping TestAuthTokenRedaction test")
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:        "http://127.0.0.1:1/unreachable",
+			HttpMethod: "GET",
+			AuthBearer: "s3cr3t-token",
+			ApiKey:     "k3y/value",
+			ApiKeyIn:   "query",
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err == nil {
+		t.Fatalf("Expected the unreachable url to fail")
+	}
+
+	if strings.Contains(err.Error(), "k3y") || !strings.Contains(err.Error(), RedactedSecret) {
+		t.Errorf("Expected the api key to be redacted from the error, got: %v", err)
+	}
+	if strings.Contains(logs.String(), "s3cr3t") || strings.Contains(logs.String(), "k3y") {
+		t.Errorf("Expected the credentials to be redacted from the logs, got:\n%s", logs.String())
+	}
+
+	shCli, dockerCli := args.EmitCommandLine()
+	for _, cli := range []string{shCli, dockerCli} {
+		if strings.Contains(cli, "s3cr3t") || strings.Contains(cli, "k3y") {
+			t.Errorf("Expected the credentials to be redacted from the command line, got:\n%s", cli)
+		}
+	}
+	if !strings.Contains(shCli, "PLUGIN_AUTH_BEARER='"+RedactedSecret+"'") {
+		t.Errorf("Expected a redacted auth_bearer in the command line, got:\n%s", shCli)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const DefaultConcurrency = 4
+
+type BatchResult struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Status   int    `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExecBatch fires one request per entry of urls, or per entry of
+// requests when batch is set, with at most concurrency requests in
+// flight. Every request is validated on its own and the step fails
+// when more than max_failures of them fail.
+func ExecBatch(ctx context.Context, args Args) error {
+
+	requests, err := GetBatchRequests(args)
+	if err != nil {
+		return err
+	}
+
+	concurrency := args.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	results := make([]BatchResult, len(requests))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = requests[index].Run()
+			}
+		}()
+	}
+
+	for index := range requests {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	if !args.Quiet {
+		LogPrintln(nil, "batch results\n"+FormatBatchSummary(results))
+	}
+
+	err = WriteBatchResults(results, failed)
+	if err != nil {
+		return err
+	}
+
+	if failed > args.MaxFailures {
+		return fmt.Errorf("%d of %d batch requests failed, max_failures is %d", failed, len(results), args.MaxFailures)
+	}
+
+	return nil
+}
+
+type BatchRequest struct {
+	Name string
+	Args Args
+}
+
+// GetBatchRequests returns the requests of the batch, each with the
+// step args it runs with.
+func GetBatchRequests(args Args) ([]BatchRequest, error) {
+
+	var requests []BatchRequest
+
+	if args.Urls != "" {
+		if args.OutputFile != "" {
+			return nil, errors.New("output_file cannot be shared by the requests of urls")
+		}
+		for _, batchUrl := range SplitSettingList(args.Urls) {
+			urlArgs := args
+			urlArgs.Urls = ""
+			urlArgs.Url = batchUrl
+			requests = append(requests, BatchRequest{Name: batchUrl, Args: urlArgs})
+		}
+	} else {
+		specs, err := LoadRequestSpecs(args.Requests)
+		if err != nil {
+			return nil, err
+		}
+		for i := range specs {
+			if len(specs[i].Capture) > 0 {
+				return nil, errors.New(specs[i].Name + ": capture is not supported in batch, the requests run concurrently")
+			}
+			specArgs := specs[i].ToArgs(args)
+			specArgs.Batch = false
+			requests = append(requests, BatchRequest{Name: specs[i].Name, Args: specArgs})
+		}
+	}
+
+	if len(requests) == 0 {
+		return nil, errors.New("batch has no requests")
+	}
+
+	return requests, nil
+}
+
+// Run executes the request as its own plugin. Results go to the batch
+// summary rather than to DRONE_OUTPUT, where the requests would
+// overwrite each other.
+func (br *BatchRequest) Run() BatchResult {
+
+	plugin := GetNewPlugin(br.Args)
+	plugin.skipOutputEnv = true
+
+	_ = plugin.Init()
+
+	start := time.Now()
+	err := plugin.Run()
+	duration := time.Since(start)
+
+	deInitErr := plugin.DeInit()
+	if err == nil {
+		err = deInitErr
+	}
+
+	result := BatchResult{
+		Name:     br.Name,
+		Url:      plugin.Url,
+		Duration: duration.Round(time.Millisecond).String(),
+	}
+
+	if plugin.httpResponse != nil {
+		result.Status = plugin.httpResponse.StatusCode
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		LogPrintf(plugin, "%s failed: %s\n", br.Name, err.Error())
+	}
+
+	return result
+}
+
+func FormatBatchSummary(results []BatchResult) string {
+
+	var out strings.Builder
+
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUEST\tSTATUS\tDURATION\tRESULT")
+	for _, result := range results {
+		outcome := "ok"
+		if result.Error != "" {
+			outcome = "FAILED: " + strings.Replace(result.Error, "\n", " ", -1)
+		}
+		status := "-"
+		if result.Status != 0 {
+			status = fmt.Sprintf("%d", result.Status)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Name, status, result.Duration, outcome)
+	}
+	w.Flush()
+
+	return out.String()
+}
+
+func WriteBatchResults(results []BatchResult, failed int) error {
+
+	resultsJson, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	type EnvKvPair struct {
+		Key   string
+		Value interface{}
+	}
+
+	var kvPairs = []EnvKvPair{
+		{"BATCH_TOTAL", len(results)},
+		{"BATCH_SUCCEEDED", len(results) - failed},
+		{"BATCH_FAILED", failed},
+		{"BATCH_RESULTS", string(resultsJson)},
+	}
+
+	for _, kvPair := range kvPairs {
+		err := WriteEnvToFile(kvPair.Key, kvPair.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
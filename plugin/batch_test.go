@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchUrlsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestBatchUrlsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestBatchUrlsWithLocalServer test")
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if strings.HasPrefix(r.URL.Path, "/down") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	var urls []string
+	for i := 0; i < 8; i++ {
+		urls = append(urls, ts.URL+"/edge"+string(rune('a'+i)))
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "drone_output")
+	defer os.Setenv("DRONE_OUTPUT", os.Getenv("DRONE_OUTPUT"))
+	os.Setenv("DRONE_OUTPUT", outputFile)
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Urls:        strings.Join(urls, ","),
+			HttpMethod:  "GET",
+			Concurrency: 3,
+			Quiet:       true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	if maxInFlight != 3 {
+		t.Errorf("Expected 3 requests in flight at most, got %d", maxInFlight)
+	}
+
+	output, _ := os.ReadFile(outputFile)
+	if !strings.Contains(string(output), "BATCH_TOTAL=8\n") || !strings.Contains(string(output), "BATCH_FAILED=0\n") {
+		t.Errorf("Expected batch totals in DRONE_OUTPUT, got:\n%s", string(output))
+	}
+	if strings.Contains(string(output), "RESPONSE_STATUS") {
+		t.Errorf("Expected no per request results in DRONE_OUTPUT, got:\n%s", string(output))
+	}
+
+	args.Urls = strings.Join(append(urls[:2], ts.URL+"/down1", ts.URL+"/down2"), "\n")
+	args.MaxFailures = 1
+
+	err = Exec(context.Background(), args)
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 batch requests failed") {
+		t.Errorf("Expected 2 failures over the threshold, got: %v", err)
+	}
+
+	args.MaxFailures = 2
+	if err := Exec(context.Background(), args); err != nil {
+		t.Errorf("Expected failures within max_failures to pass, got: %v", err)
+	}
+}
+
+func TestBatchRequestSpecsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestBatchRequestSpecsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestBatchRequestSpecsWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Requests: `[
+				{"name": "purge a", "url": "` + ts.URL + `/a", "method": "DELETE", "valid_response_body": "DELETE /a"},
+				{"name": "purge b", "url": "` + ts.URL + `/b", "method": "DELETE", "valid_response_body": "DELETE /a"}
+			]`,
+			Batch: true,
+			Quiet: true,
+		},
+	}
+
+	requests, err := GetBatchRequests(args)
+	if err != nil {
+		t.Fatalf("GetBatchRequests() returned an error: %v", err)
+	}
+
+	results := []BatchResult{requests[0].Run(), requests[1].Run()}
+	if results[0].Error != "" || results[0].Status != http.StatusOK {
+		t.Errorf("Expected purge a to pass, got %+v", results[0])
+	}
+	if results[1].Error == "" {
+		t.Errorf("Expected purge b to fail validation, got %+v", results[1])
+	}
+
+	summary := FormatBatchSummary(results)
+	if !strings.Contains(summary, "purge a") || !strings.Contains(summary, "FAILED: response body does not contain") {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+
+	args.Requests = `[{"name": "login", "url": "` + ts.URL + `/login", "capture": {"token": "$.token"}}]`
+	if _, err := GetBatchRequests(args); err == nil || !strings.Contains(err.Error(), "login: capture is not supported in batch") {
+		t.Errorf("Expected capture in a batch spec to be rejected, got: %v", err)
+	}
+}
@@ -3,8 +3,9 @@ package plugin
 import (
 	"crypto/tls"
 	"errors"
+	"net"
 	"net/http"
-	"net/url"
+	"time"
 )
 
 /*
@@ -12,191 +13,119 @@ import (
 	SSL no ignore is to have a secure connection with the server
 	SSL is proxy is to go through a proxy server
 
-	All these are independent of each other and 8 combinations are possible
-
-	isIgnoreSsl,isClientCert,isProxy,Combination Description
-	false,false,false,SSL required, no client cert, no proxy
-	false,false,true,SSL required, no client cert, proxy enabled
-	false,true,false,SSL required, client cert provided, no proxy
-	false,true,true,SSL required, client cert provided, proxy enabled
-	true,false,false,No SSL, no client cert, no proxy
-	true,false,true,No SSL skipping, no client cert, proxy enabled
-	true,true,false,No SSL skipping, client cert provided, no proxy
-	true,true,true,No SSL skipping, client cert provided, proxy enabled
+	All these are independent of each other, so instead of a client for
+	every combination the transport is built in layers: the tls settings,
+	the client identity and CA pool, the tls policy, the connection
+	settings, the timeouts and the proxy, each layer only touching its
+	part of the transport. A new connection feature is a new layer.
 
+	The http client keeps the timeout of GetNewHttpClient, whatever the
+	transport ends up being.
 */
 
-func (p *Plugin) SetHttpConnectionParameters() error {
-
-	isIgnoreSsl := p.IgnoreSsl
-	isClientCert := p.SslCertPath != ""
-	isProxy := p.Proxy != ""
+const (
+	DefaultConnectTimeout      = 30 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+	DefaultTlsHandshakeTimeout = 10 * time.Second
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
 
-	LogPrintf(p, "Configuration Ignore SSL: %t, Client Cert: %t, Proxy: %t\n", isIgnoreSsl, isClientCert, isProxy)
+// TransportLayer sets one group of settings on the transport.
+type TransportLayer func(transport *http.Transport) error
 
-	var err error
+func (p *Plugin) SetHttpConnectionParameters() error {
 
-	switch {
-	// SSL required, no client cert, no proxy
-	case !isIgnoreSsl && !isClientCert && !isProxy:
-		p.httpClient, err = setupSslNoClientCertNoProxy()
-		if err != nil {
-			return err
-		}
+	LogPrintf(p, "Configuration Ignore SSL: %t, Client Cert: %t, Proxy: %t\n",
+		p.IgnoreSsl, p.SslCertPath != "" || p.clientCertificate != nil, p.Proxy != "" || p.ProxyFromEnv)
 
-	// SSL required, no client cert, proxy enabled
-	case !isIgnoreSsl && !isClientCert && isProxy:
-		p.httpClient, err = setupSslNoClientCertWithProxy(p.Proxy)
-		if err != nil {
-			return err
-		}
+	transport, err := p.NewHttpTransport()
+	if err != nil {
+		return err
+	}
 
-	// SSL required, client cert provided, no proxy
-	case !isIgnoreSsl && isClientCert && !isProxy:
-		p.httpClient, err = setupSslWithClientCertNoProxy(p.SslCertPath)
-		if err != nil {
-			return err
-		}
+	if p.httpClient == nil {
+		p.GetNewHttpClient()
+	}
+	p.httpClient.Transport = transport
 
-	// SSL required, client cert provided, proxy enabled
-	case !isIgnoreSsl && isClientCert && isProxy:
-		p.httpClient, err = setupSslWithClientCertWithProxy(p.SslCertPath, p.Proxy)
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-	// No SSL, no client cert, no proxy
-	case isIgnoreSsl && !isClientCert && !isProxy:
-		p.httpClient, err = setupNoSslNoClientCertNoProxy()
-		if err != nil {
-			return err
-		}
+// NewHttpTransport builds the transport out of the layers of the
+// plugin settings.
+func (p *Plugin) NewHttpTransport() (*http.Transport, error) {
 
-	// No SSL, no client cert, proxy enabled
-	case isIgnoreSsl && !isClientCert && isProxy:
-		p.httpClient, err = setupNoSslNoClientCertWithProxy(p.Proxy)
-		if err != nil {
-			return err
-		}
+	transport := &http.Transport{
+		MaxIdleConns:          100,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   DefaultTlsHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
 
-	// No SSL, client cert provided, no proxy
-	case isIgnoreSsl && isClientCert && !isProxy:
-		p.httpClient, err = setupNoSslWithClientCertNoProxy(p.SslCertPath)
-		if err != nil {
-			return err
-		}
+	layers := []TransportLayer{
+		p.SetTransportTls,
+		p.ApplyClientTls,
+		p.SetTransportTlsPolicy,
+		p.SetTransportConnections,
+		p.SetTransportTimeouts,
+		// the proxy goes last, a socks proxy dials on top of the
+		// connection settings
+		p.SetTransportProxy,
+	}
 
-	// No SSL, client cert provided, proxy enabled
-	case isIgnoreSsl && isClientCert && isProxy:
-		p.httpClient, err = setupNoSslWithClientCertWithProxy(p.SslCertPath, p.Proxy)
-		if err != nil {
-			return err
+	for _, layer := range layers {
+		if err := layer(transport); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return transport, nil
 }
 
-// SSL required, no client cert, no proxy
-func setupSslNoClientCertNoProxy() (*http.Client, error) {
-	tlsConfig := &tls.Config{InsecureSkipVerify: false}
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
-	return &http.Client{Transport: transport}, nil
-}
+// SetTransportTls sets the server verification and the combined
+// certificate and key of ssl_cert_path.
+func (p *Plugin) SetTransportTls(transport *http.Transport) error {
 
-// SSL required, no client cert, proxy enabled
-func setupSslNoClientCertWithProxy(proxy string) (*http.Client, error) {
-	tlsConfig := &tls.Config{InsecureSkipVerify: false}
-	transport, err := createTransportWithProxy(proxy, tlsConfig)
-	if err != nil {
-		return nil, err
-	}
-	return &http.Client{Transport: transport}, nil
-}
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.IgnoreSsl}
 
-// SSL required, client cert provided, no proxy
-func setupSslWithClientCertNoProxy(certPath string) (*http.Client, error) {
-	tlsConfig, err := createTlsConfigWithClientCert(certPath, false)
-	if err != nil {
-		return nil, err
+	if p.SslCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(p.SslCertPath, p.SslCertPath)
+		if err != nil {
+			return errors.New("failed to load client certificate " + p.SslCertPath + " " + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
-	return &http.Client{Transport: transport}, nil
-}
 
-// SSL required, client cert provided, proxy enabled
-func setupSslWithClientCertWithProxy(certPath string, proxy string) (*http.Client, error) {
-	tlsConfig, err := createTlsConfigWithClientCert(certPath, false)
-	if err != nil {
-		return nil, err
-	}
-	transport, err := createTransportWithProxy(proxy, tlsConfig)
-	if err != nil {
-		return nil, err
-	}
-	return &http.Client{Transport: transport}, nil
+	transport.TLSClientConfig = tlsConfig
+	return nil
 }
 
-// no SSL, no client cert, no proxy
-func setupNoSslNoClientCertNoProxy() (*http.Client, error) {
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
-	return &http.Client{Transport: transport}, nil
-}
+// SetTransportConnections sets how connections are dialed and kept.
+// HTTP/2 is opt in, NTLM authenticates the connection and needs
+// HTTP/1.1 with keep-alive.
+func (p *Plugin) SetTransportConnections(transport *http.Transport) error {
 
-// no SSL, no client cert, proxy enabled
-func setupNoSslNoClientCertWithProxy(proxy string) (*http.Client, error) {
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
-	transport, err := createTransportWithProxy(proxy, tlsConfig)
-	if err != nil {
-		return nil, err
+	if p.Http2 && p.AuthNtlm != "" {
+		return errors.New("http2 cannot be combined with auth_ntlm")
 	}
-	return &http.Client{Transport: transport}, nil
-}
-
-// no SSL, client cert provided, no proxy
-func setupNoSslWithClientCertNoProxy(certPath string) (*http.Client, error) {
-	tlsConfig, err := createTlsConfigWithClientCert(certPath, true)
-	if err != nil {
-		return nil, err
+	if p.DisableKeepAlive && p.AuthNtlm != "" {
+		return errors.New("disable_keep_alive cannot be combined with auth_ntlm, the ntlm handshake needs one connection")
 	}
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
-	return &http.Client{Transport: transport}, nil
-}
 
-// no SSL, client cert provided, proxy enabled
-func setupNoSslWithClientCertWithProxy(certPath string, proxy string) (*http.Client, error) {
-	tlsConfig, err := createTlsConfigWithClientCert(certPath, true)
-	if err != nil {
-		return nil, err
+	dialer := &net.Dialer{
+		Timeout:   DefaultConnectTimeout,
+		KeepAlive: DefaultKeepAlive,
 	}
-	transport, err := createTransportWithProxy(proxy, tlsConfig)
-	if err != nil {
-		return nil, err
+	if p.connectTimeout > 0 {
+		dialer.Timeout = p.connectTimeout
 	}
-	return &http.Client{Transport: transport}, nil
-}
-
-// Function to create TLS configuration with client certificate
-func createTlsConfigWithClientCert(certPath string, ignoreSsl bool) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(certPath, certPath)
-	if err != nil {
-		return nil, errors.New("failed to load client certificate " + certPath + " " + err.Error())
+	if p.DisableKeepAlive {
+		dialer.KeepAlive = -1
 	}
-	return &tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		InsecureSkipVerify: ignoreSsl,
-	}, nil
-}
 
-// Function to create HTTP transport with proxy and TLS configuration
-func createTransportWithProxy(proxyUrl string, tlsConfig *tls.Config) (*http.Transport, error) {
-	proxy, err := url.Parse(proxyUrl)
-	if err != nil {
-		return nil, errors.New("invalid proxy URL: " + err.Error())
-	}
-	return &http.Transport{
-		Proxy:           http.ProxyURL(proxy),
-		TLSClientConfig: tlsConfig,
-	}, nil
+	transport.DialContext = dialer.DialContext
+	transport.DisableKeepAlives = p.DisableKeepAlive
+	transport.ForceAttemptHTTP2 = p.Http2
+
+	return nil
 }
@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransportBuilderCombinations(t *testing.T) {
+
+	_, found := enableTests["TestTransportBuilderCombinations"]
+	if !found {
+		t.Skip("Skipping TestTransportBuilderCombinations test")
+	}
+
+	certPem, _ := os.ReadFile(clientTlsCertPath)
+	keyPem, _ := os.ReadFile(clientTlsKeyPath)
+	certName := filepath.Join(t.TempDir(), "client.pem")
+	os.WriteFile(certName, append(certPem, keyPem...), 0600)
+
+	for combination := 0; combination < 8; combination++ {
+		isIgnoreSsl := combination&1 != 0
+		isClientCert := combination&2 != 0
+		isProxy := combination&4 != 0
+
+		plugin := &Plugin{}
+		plugin.Timeout = 7
+		plugin.IgnoreSsl = isIgnoreSsl
+		plugin.Quiet = true
+		if isClientCert {
+			plugin.SslCertPath = certName
+		}
+		if isProxy {
+			plugin.Proxy = "http://proxy.example.com:3128"
+		}
+
+		plugin.SetTimeout()
+		plugin.GetNewHttpClient()
+		if err := plugin.SetHttpConnectionParameters(); err != nil {
+			t.Fatalf("combination %d: %v", combination, err)
+		}
+
+		if plugin.httpClient.Timeout != 7*time.Second {
+			t.Errorf("combination %d: expected the 7s timeout to be kept, got %s", combination, plugin.httpClient.Timeout)
+		}
+
+		transport := plugin.httpClient.Transport.(*http.Transport)
+		if transport.TLSClientConfig.InsecureSkipVerify != isIgnoreSsl {
+			t.Errorf("combination %d: expected InsecureSkipVerify %t", combination, isIgnoreSsl)
+		}
+		if (len(transport.TLSClientConfig.Certificates) == 1) != isClientCert {
+			t.Errorf("combination %d: expected client certificate %t", combination, isClientCert)
+		}
+		if (transport.Proxy != nil) != isProxy {
+			t.Errorf("combination %d: expected proxy %t", combination, isProxy)
+		}
+		if transport.DialContext == nil || transport.ForceAttemptHTTP2 || transport.DisableKeepAlives {
+			t.Errorf("combination %d: unexpected connection settings", combination)
+		}
+	}
+
+	plugin := &Plugin{}
+	plugin.Http2 = true
+	plugin.AuthNtlm = `CORP\build:pass`
+	if _, err := plugin.NewHttpTransport(); err == nil {
+		t.Errorf("Expected http2 with auth_ntlm to be rejected")
+	}
+
+	plugin.Http2 = false
+	plugin.DisableKeepAlive = true
+	if _, err := plugin.NewHttpTransport(); err == nil {
+		t.Errorf("Expected disable_keep_alive with auth_ntlm to be rejected")
+	}
+}
+
+func TestTransportBuilderWithLocalProxy(t *testing.T) {
+
+	_, found := enableTests["TestTransportBuilderWithLocalProxy"]
+	if !found {
+		t.Skip("Skipping TestTransportBuilderWithLocalProxy test")
+	}
+
+	var proxied []string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(3 * time.Second):
+			}
+		}
+	}))
+	defer proxy.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:        "http://upstream.invalid/status",
+			HttpMethod: "GET",
+			Proxy:      proxy.URL,
+			IgnoreSsl:  true,
+			Quiet:      true,
+		},
+	}
+
+	if err := Exec(context.Background(), args); err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://upstream.invalid/status" {
+		t.Fatalf("Expected the request to go through the proxy, got %v", proxied)
+	}
+
+	args.Url = "http://upstream.invalid/slow"
+	args.Timeout = 1
+	start := time.Now()
+	if err := Exec(context.Background(), args); err == nil {
+		t.Fatalf("Expected the request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the 1s timeout through the proxy, took %s", elapsed)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+/*
+	client_cert, client_key and ca_cert take either the path of a PEM
+	file or the PEM content itself, as it comes out of a secret. The key
+	may be left out when client_cert holds both. An encrypted key, in
+	the legacy PEM form or as PKCS#8 with PBES2, is decrypted with
+	client_key_password. ca_cert adds private roots to the system pool.
+
+	client_pkcs12 is the path of a .p12 or .pfx bundle, or the bundle
+	itself encoded as base64, decrypted with client_pkcs12_password.
+	The chain certificates of the bundle are sent along with the leaf.
+*/
+
+// LoadPemSetting returns the PEM content of a setting that is either
+// inline PEM or a file path.
+func LoadPemSetting(name, value string) ([]byte, error) {
+
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+
+	data, err := os.ReadFile(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.New("cannot read " + name + ": " + err.Error())
+	}
+
+	return data, nil
+}
+
+// ValidateClientTls loads the client identity and the CA bundle.
+func (p *Plugin) ValidateClientTls() error {
+
+	p.clientCertificate = nil
+	p.caCertPool = nil
+
+	if p.ClientCert == "" && (p.ClientKey != "" || p.ClientKeyPassword != "") {
+		return errors.New("client_cert is required with client_key")
+	}
+
+	if p.ClientPkcs12 == "" && p.ClientPkcs12Password != "" {
+		return errors.New("client_pkcs12 is required with client_pkcs12_password")
+	}
+
+	if p.ClientPkcs12 != "" {
+		if p.ClientCert != "" || p.SslCertPath != "" {
+			return errors.New("client_pkcs12 cannot be combined with client_cert or ssl_cert_path")
+		}
+
+		certificate, err := LoadPkcs12Setting(p.ClientPkcs12, p.ClientPkcs12Password)
+		if err != nil {
+			return err
+		}
+		p.clientCertificate = certificate
+	}
+
+	if p.ClientCert != "" {
+		if p.SslCertPath != "" {
+			return errors.New("client_cert cannot be combined with ssl_cert_path")
+		}
+
+		certPem, err := LoadPemSetting("client_cert", p.ClientCert)
+		if err != nil {
+			return err
+		}
+
+		keyPem := certPem
+		if p.ClientKey != "" {
+			keyPem, err = LoadPemSetting("client_key", p.ClientKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		keyPem, err = decryptPrivateKeyPem(keyPem, p.ClientKeyPassword)
+		if err != nil {
+			return err
+		}
+
+		certificate, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return errors.New("invalid client_cert or client_key: " + err.Error())
+		}
+		p.clientCertificate = &certificate
+	}
+
+	if p.CaCert != "" {
+		caPem, err := LoadPemSetting("ca_cert", p.CaCert)
+		if err != nil {
+			return err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPem) {
+			return errors.New("ca_cert holds no PEM certificate")
+		}
+		p.caCertPool = pool
+	}
+
+	return nil
+}
+
+// LoadPkcs12Setting decodes the bundle of client_pkcs12 into a client
+// certificate with its chain.
+func LoadPkcs12Setting(value, password string) (*tls.Certificate, error) {
+
+	data, err := os.ReadFile(strings.TrimSpace(value))
+	if err != nil {
+		var decodeErr error
+		data, decodeErr = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		if decodeErr != nil {
+			return nil, errors.New("cannot read client_pkcs12: " + err.Error())
+		}
+	}
+
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.New("cannot decode client_pkcs12: " + err.Error())
+	}
+
+	certificate := &tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, ca := range chain {
+		certificate.Certificate = append(certificate.Certificate, ca.Raw)
+	}
+
+	return certificate, nil
+}
+
+// ApplyClientTls adds the client identity and the CA bundle to the
+// tls settings of the transport.
+func (p *Plugin) ApplyClientTls(transport *http.Transport) error {
+
+	if p.clientCertificate == nil && p.caCertPool == nil {
+		return nil
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if p.clientCertificate != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*p.clientCertificate}
+	}
+	if p.caCertPool != nil {
+		transport.TLSClientConfig.RootCAs = p.caCertPool
+	}
+
+	return nil
+}
+
+// decryptPrivateKeyPem returns the PEM with its private key decrypted,
+// the other blocks are kept as they are.
+func decryptPrivateKeyPem(data []byte, password string) ([]byte, error) {
+
+	var out []byte
+	encrypted := false
+
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		data = rest
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			encrypted = true
+			if password == "" {
+				return nil, errors.New("client_key is encrypted, client_key_password is required")
+			}
+			der, err := decryptPkcs8(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+
+		// the legacy Proc-Type form, deprecated but still issued by
+		// older tooling
+		case x509.IsEncryptedPEMBlock(block):
+			encrypted = true
+			if password == "" {
+				return nil, errors.New("client_key is encrypted, client_key_password is required")
+			}
+			der, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return nil, errors.New("cannot decrypt client_key: " + err.Error())
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+
+	if !encrypted && password != "" {
+		return nil, errors.New("client_key_password is set but client_key is not encrypted")
+	}
+
+	return out, nil
+}
+
+var (
+	oidPbes2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPbkdf2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHmacWithSha1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHmacWithSha256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAes128Cbc      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAes192Cbc      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAes256Cbc      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type pkcs8EncryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	Prf            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPkcs8 decrypts a PKCS#8 key encrypted with PBES2, PBKDF2 and
+// AES-CBC, what OpenSSL writes by default. Only the parameters are
+// parsed here, the key is derived by x/crypto/pbkdf2.
+func decryptPkcs8(der, password []byte) ([]byte, error) {
+
+	unsupported := errors.New("unsupported client_key encryption, expected PBES2 with PBKDF2 and AES-CBC")
+
+	var info pkcs8EncryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil || !info.Algorithm.Algorithm.Equal(oidPbes2) {
+		return nil, unsupported
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil ||
+		!params.KeyDerivationFunc.Algorithm.Equal(oidPbkdf2) {
+		return nil, unsupported
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil || kdf.IterationCount < 1 {
+		return nil, unsupported
+	}
+
+	prf := sha1.New
+	switch {
+	case kdf.Prf.Algorithm == nil, kdf.Prf.Algorithm.Equal(oidHmacWithSha1):
+	case kdf.Prf.Algorithm.Equal(oidHmacWithSha256):
+		prf = sha256.New
+	default:
+		return nil, unsupported
+	}
+
+	keyLength := 0
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAes128Cbc):
+		keyLength = 16
+	case scheme.Equal(oidAes192Cbc):
+		keyLength = 24
+	case scheme.Equal(oidAes256Cbc):
+		keyLength = 32
+	default:
+		return nil, unsupported
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, unsupported
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(password, kdf.Salt, kdf.IterationCount, keyLength, prf))
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("cannot decrypt client_key, bad length")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, errors.New("cannot decrypt client_key, wrong client_key_password")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("cannot decrypt client_key, wrong client_key_password")
+		}
+	}
+
+	return plain[:len(plain)-padding], nil
+}
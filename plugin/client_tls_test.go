@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	clientTlsCaPath               = "./bogus_client_ca.pem"
+	clientTlsCertPath             = "./bogus_client_cert.pem"
+	clientTlsKeyPath              = "./bogus_client.key.pem"
+	clientTlsEncryptedKeyPath     = "./bogus_client_encrypted.key.pem"
+	clientTlsLegacyKeyPath        = "./bogus_client_legacy_encrypted.key.pem"
+	clientTlsPkcs12Path           = "./bogus_client.p12"
+	clientTlsEncryptedKeyPassword = "t3st-passw0rd"
+)
+
+// newClientTlsTestServer starts a server that requires a client
+// certificate issued by the bogus test ca, it records the common name of
+// the clients and returns its own certificate as PEM.
+func newClientTlsTestServer(t *testing.T, clients *[]string) (*httptest.Server, string) {
+
+	caPem, err := os.ReadFile(clientTlsCaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCas := x509.NewCertPool()
+	clientCas.AppendCertsFromPEM(caPem)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*clients = append(*clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCas}
+	ts.StartTLS()
+
+	return ts, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+}
+
+func TestClientTlsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestClientTlsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestClientTlsWithLocalServer test")
+	}
+
+	var clients []string
+	ts, serverCa := newClientTlsTestServer(t, &clients)
+	defer ts.Close()
+
+	certPem, _ := os.ReadFile(clientTlsCertPath)
+	keyPem, _ := os.ReadFile(clientTlsKeyPath)
+	encryptedKeyPem, _ := os.ReadFile(clientTlsEncryptedKeyPath)
+
+	identities := []PluginInputParams{
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsKeyPath},
+		{ClientCert: string(certPem), ClientKey: string(keyPem)},
+		{ClientCert: string(certPem) + string(keyPem)},
+		{ClientCert: clientTlsCertPath, ClientKey: string(encryptedKeyPem), ClientKeyPassword: clientTlsEncryptedKeyPassword},
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsLegacyKeyPath, ClientKeyPassword: clientTlsEncryptedKeyPassword},
+	}
+
+	for i, params := range identities {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.CaCert = serverCa
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err != nil {
+			t.Fatalf("Exec() with identity %d returned an error: %v", i, err)
+		}
+	}
+
+	if len(clients) != len(identities) {
+		t.Fatalf("Expected %d requests, got %d", len(identities), len(clients))
+	}
+	for _, client := range clients {
+		if client != "bogus test client" {
+			t.Errorf("Expected the bogus test client certificate, got %s", client)
+		}
+	}
+
+	invalid := []PluginInputParams{
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsKeyPath},
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsEncryptedKeyPath, CaCert: serverCa},
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsEncryptedKeyPath, ClientKeyPassword: "wrong", CaCert: serverCa},
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsLegacyKeyPath, ClientKeyPassword: "wrong", CaCert: serverCa},
+		{ClientCert: clientTlsCertPath, ClientKey: clientTlsKeyPath, ClientKeyPassword: "unused", CaCert: serverCa},
+		{ClientKey: clientTlsKeyPath, CaCert: serverCa},
+		{CaCert: serverCa},
+		{CaCert: "./missing_ca.pem"},
+	}
+	for i, params := range invalid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected invalid settings %d to fail", i)
+		}
+	}
+}
+
+func TestClientPkcs12WithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestClientPkcs12WithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestClientPkcs12WithLocalServer test")
+	}
+
+	var clients []string
+	ts, serverCa := newClientTlsTestServer(t, &clients)
+	defer ts.Close()
+
+	bundle, err := os.ReadFile(clientTlsPkcs12Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{clientTlsPkcs12Path, base64.StdEncoding.EncodeToString(bundle)} {
+		params := PluginInputParams{
+			Url:                  ts.URL,
+			HttpMethod:           "GET",
+			ClientPkcs12:         value,
+			ClientPkcs12Password: clientTlsEncryptedKeyPassword,
+			CaCert:               serverCa,
+			Quiet:                true,
+		}
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err != nil {
+			t.Fatalf("Exec() returned an error: %v", err)
+		}
+	}
+
+	if len(clients) != 2 || clients[0] != "bogus test client" {
+		t.Fatalf("Expected two requests with the bogus test client certificate, got %v", clients)
+	}
+
+	plugin := &Plugin{}
+	plugin.ClientPkcs12 = clientTlsPkcs12Path
+	plugin.ClientPkcs12Password = clientTlsEncryptedKeyPassword
+	if err := plugin.ValidateClientTls(); err != nil {
+		t.Fatal(err)
+	}
+	if len(plugin.clientCertificate.Certificate) != 2 {
+		t.Errorf("Expected the ca of the bundle to be sent along, got %d certificates", len(plugin.clientCertificate.Certificate))
+	}
+
+	invalid := []PluginInputParams{
+		{ClientPkcs12: clientTlsPkcs12Path, ClientPkcs12Password: "wrong"},
+		{ClientPkcs12: "./missing.p12", ClientPkcs12Password: clientTlsEncryptedKeyPassword},
+		{ClientPkcs12: clientTlsPkcs12Path, ClientPkcs12Password: clientTlsEncryptedKeyPassword, ClientCert: clientTlsCertPath},
+		{ClientPkcs12Password: clientTlsEncryptedKeyPassword},
+	}
+	for i, params := range invalid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.CaCert = serverCa
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected invalid settings %d to fail", i)
+		}
+	}
+}
+
+func TestAuthCertIsSslCertPath(t *testing.T) {
+
+	_, found := enableTests["TestAuthCertIsSslCertPath"]
+	if !found {
+		t.Skip("Skipping TestAuthCertIsSslCertPath test")
+	}
+
+	certPem, _ := os.ReadFile(clientTlsCertPath)
+	keyPem, _ := os.ReadFile(clientTlsKeyPath)
+	certName := filepath.Join(t.TempDir(), "client.pem")
+	os.WriteFile(certName, append(certPem, keyPem...), 0600)
+
+	plugin := &Plugin{}
+	plugin.AuthCert = certName
+	plugin.Quiet = true
+	if err := plugin.ValidateAuthCert(); err != nil {
+		t.Fatal(err)
+	}
+	if plugin.SslCertPath != certName {
+		t.Errorf("Expected auth_cert to set ssl_cert_path, got %q", plugin.SslCertPath)
+	}
+
+	plugin = &Plugin{}
+	plugin.AuthCert = certName
+	plugin.SslCertPath = clientTlsCertPath
+	if err := plugin.ValidateAuthCert(); err == nil {
+		t.Errorf("Expected different auth_cert and ssl_cert_path to be rejected")
+	}
+
+	plugin = &Plugin{}
+	plugin.SslCertPath = clientTlsCertPath
+	if err := plugin.ValidateAuthCert(); err == nil {
+		t.Errorf("Expected ssl_cert_path without a private key to be rejected")
+	}
+}
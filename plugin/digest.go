@@ -0,0 +1,239 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+const (
+	DigestQopAuth    = "auth"
+	DigestQopAuthInt = "auth-int"
+)
+
+type DigestCredentials struct {
+	User string
+	Pass string
+}
+
+// DigestChallenge is the challenge the request answers, Qop is the
+// quality of protection picked from the ones the server offered.
+type DigestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       string
+	Stale     bool
+	nc        int
+}
+
+// digestAlgorithms maps the supported algorithms to their hash and
+// preference, sha-256 is preferred when the server offers both.
+var digestAlgorithms = map[string]struct {
+	newHash    func() hash.Hash
+	preference int
+}{
+	"MD5":          {md5.New, 1},
+	"MD5-SESS":     {md5.New, 1},
+	"SHA-256":      {sha256.New, 2},
+	"SHA-256-SESS": {sha256.New, 2},
+}
+
+// ValidateAuthDigest splits auth_digest, written as user:pass, the
+// password may contain colons.
+func (p *Plugin) ValidateAuthDigest() error {
+
+	p.digestCredentials = nil
+
+	if p.AuthDigest == "" {
+		return nil
+	}
+
+	if p.IsAuthBasic() || p.AuthBearer != "" || p.AuthBearerFile != "" || p.IsOAuth2() || p.AuthAwsSigv4 {
+		return errors.New("auth_digest cannot be combined with auth_basic, auth_bearer, oauth2 or auth_aws_sigv4")
+	}
+
+	userPass := strings.SplitN(p.AuthDigest, ":", 2)
+	if len(userPass) != 2 || userPass[0] == "" {
+		return errors.New("invalid auth_digest format, expected user:pass")
+	}
+
+	p.digestCredentials = &DigestCredentials{User: userPass[0], Pass: userPass[1]}
+	return nil
+}
+
+// AnswerDigestChallenge takes the digest challenge of a 401 response.
+// A challenge is answered once, a second one only when it says that
+// the nonce of the first one went stale.
+func (p *Plugin) AnswerDigestChallenge(resp *http.Response) (bool, error) {
+
+	challenge, err := ParseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if err != nil || challenge == nil {
+		return false, err
+	}
+
+	if p.digestChallenge != nil && (!challenge.Stale || p.digestChallenge.Stale) {
+		return false, nil
+	}
+
+	p.digestChallenge = challenge
+	LogPrintf(p, "answering digest challenge, algorithm %s\n", challenge.Algorithm)
+
+	return true, nil
+}
+
+// SetAuthDigest answers the current digest challenge, if any, with a
+// fresh client nonce and the next nonce count.
+func (p *Plugin) SetAuthDigest() error {
+
+	challenge := p.digestChallenge
+	if challenge == nil || p.digestCredentials == nil {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetAuthDigest http request is nil")
+	}
+
+	algorithm := strings.ToUpper(challenge.Algorithm)
+	newHash := digestAlgorithms[algorithm].newHash
+
+	digest := func(values ...string) string {
+		h := newHash()
+		h.Write([]byte(strings.Join(values, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+
+	challenge.nc++
+	nc := fmt.Sprintf("%08x", challenge.nc)
+	uri := p.HttpReq.URL.RequestURI()
+
+	ha1 := digest(p.digestCredentials.User, challenge.Realm, p.digestCredentials.Pass)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = digest(ha1, challenge.Nonce, cnonce)
+	}
+
+	ha2 := digest(p.HttpReq.Method, uri)
+	if challenge.Qop == DigestQopAuthInt {
+		bodyHash := newHash()
+		err := p.HashRequestBody(bodyHash)
+		if err != nil {
+			return err
+		}
+		ha2 = digest(p.HttpReq.Method, uri, hex.EncodeToString(bodyHash.Sum(nil)))
+	}
+
+	var response string
+	if challenge.Qop == "" {
+		response = digest(ha1, challenge.Nonce, ha2)
+	} else {
+		response = digest(ha1, challenge.Nonce, nc, cnonce, challenge.Qop, ha2)
+	}
+
+	params := []string{
+		"username=" + quoteAuthParam(p.digestCredentials.User),
+		"realm=" + quoteAuthParam(challenge.Realm),
+		"nonce=" + quoteAuthParam(challenge.Nonce),
+		"uri=" + quoteAuthParam(uri),
+		"algorithm=" + challenge.Algorithm,
+		"response=" + quoteAuthParam(response),
+	}
+	if challenge.Opaque != "" {
+		params = append(params, "opaque="+quoteAuthParam(challenge.Opaque))
+	}
+	if challenge.Qop != "" {
+		params = append(params, "qop="+challenge.Qop, "nc="+nc, "cnonce="+quoteAuthParam(cnonce))
+	}
+
+	p.HttpReq.Header.Set(AuthorizationHeader, "Digest "+strings.Join(params, ", "))
+
+	return nil
+}
+
+// ParseDigestChallenge picks the strongest digest challenge out of the
+// WWW-Authenticate headers, it returns nil when there is none.
+func ParseDigestChallenge(values []string) (*DigestChallenge, error) {
+
+	var best *DigestChallenge
+	bestPreference := 0
+	unsupported := ""
+
+	for _, authChallenge := range ParseAuthChallenges(values) {
+		if !strings.EqualFold(authChallenge.Scheme, "Digest") {
+			continue
+		}
+
+		params := authChallenge.Params
+
+		algorithm := params["algorithm"]
+		if algorithm == "" {
+			algorithm = "MD5"
+		}
+		supported, ok := digestAlgorithms[strings.ToUpper(algorithm)]
+		if !ok {
+			unsupported = algorithm
+			continue
+		}
+
+		qop := ""
+		offered := strings.Split(params["qop"], ",")
+		for i := range offered {
+			offered[i] = strings.ToLower(strings.TrimSpace(offered[i]))
+		}
+		for _, candidate := range []string{DigestQopAuth, DigestQopAuthInt} {
+			if qop == "" && containsString(offered, candidate) {
+				qop = candidate
+			}
+		}
+		if qop == "" && params["qop"] != "" {
+			unsupported = "qop " + params["qop"]
+			continue
+		}
+
+		if params["nonce"] == "" || supported.preference <= bestPreference {
+			continue
+		}
+
+		bestPreference = supported.preference
+		best = &DigestChallenge{
+			Realm:     params["realm"],
+			Nonce:     params["nonce"],
+			Opaque:    params["opaque"],
+			Algorithm: algorithm,
+			Qop:       qop,
+			Stale:     strings.EqualFold(params["stale"], "true"),
+		}
+	}
+
+	if best == nil && unsupported != "" {
+		return nil, errors.New("unsupported digest challenge " + unsupported)
+	}
+
+	return best, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthChallenges(t *testing.T) {
+
+	_, found := enableTests["TestParseAuthChallenges"]
+	if !found {
+		t.Skip("Skipping TestParseAuthChallenges test")
+	}
+
+	challenges := ParseAuthChallenges([]string{
+		`Basic realm="legacy", Digest realm="pdu, rack 4", qop="auth,auth-int", nonce="abc\"def", algorithm=SHA-256`,
+		`NTLM TlRMTVNTUAACAAAADAAMADgAAAA=`,
+		`Negotiate`,
+	})
+
+	expected := []AuthChallenge{
+		{Scheme: "Basic", Params: map[string]string{"realm": "legacy"}},
+		{Scheme: "Digest", Params: map[string]string{"realm": "pdu, rack 4", "qop": "auth,auth-int", "nonce": `abc"def`, "algorithm": "SHA-256"}},
+		{Scheme: "NTLM", Token: "TlRMTVNTUAACAAAADAAMADgAAAA=", Params: map[string]string{}},
+		{Scheme: "Negotiate", Params: map[string]string{}},
+	}
+
+	if !reflect.DeepEqual(challenges, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, challenges)
+	}
+
+	challenge, err := ParseDigestChallenge([]string{
+		`Digest realm="r", nonce="n1", qop="auth"`,
+		`Digest realm="r", nonce="n2", qop="auth", algorithm=SHA-256`,
+	})
+	if err != nil || challenge.Nonce != "n2" || challenge.Qop != "auth" {
+		t.Errorf("Expected the sha-256 challenge, got %+v %v", challenge, err)
+	}
+
+	_, err = ParseDigestChallenge([]string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`})
+	if err == nil {
+		t.Errorf("Expected an unsupported algorithm to be an error")
+	}
+}
+
+// newDigestTestServer verifies digest answers the way RFC 7616 servers
+// do, the first nonce it hands out is reported stale once it is used.
+func newDigestTestServer(algorithm, qop string, received *[]string) *httptest.Server {
+
+	nonces := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*received = append(*received, r.Header.Get("Authorization"))
+
+		newHash := md5.New
+		if strings.HasPrefix(algorithm, "SHA-256") {
+			newHash = sha256.New
+		}
+		digest := func(values ...string) string {
+			var h hash.Hash = newHash()
+			h.Write([]byte(strings.Join(values, ":")))
+			return hex.EncodeToString(h.Sum(nil))
+		}
+
+		challenge := func(stale bool) {
+			nonces++
+			w.Header().Add("WWW-Authenticate", `Basic realm="appliance"`)
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="appliance", qop="%s", nonce="nonce-%d", opaque="0p4que", algorithm=%s, stale=%t`,
+				qop, nonces, algorithm, stale))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+
+		challenges := ParseAuthChallenges([]string{r.Header.Get("Authorization")})
+		if len(challenges) != 1 || challenges[0].Scheme != "Digest" {
+			challenge(false)
+			return
+		}
+		params := challenges[0].Params
+
+		if params["nonce"] == "nonce-1" && nonces == 1 {
+			challenge(true)
+			return
+		}
+
+		ha1 := digest("admin", "appliance", "pa:ss")
+		if strings.HasSuffix(algorithm, "-sess") {
+			ha1 = digest(ha1, params["nonce"], params["cnonce"])
+		}
+		ha2 := digest(r.Method, params["uri"])
+		if params["qop"] == "auth-int" {
+			ha2 = digest(r.Method, params["uri"], digest(string(body)))
+		}
+		response := digest(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+
+		if params["response"] != response || params["uri"] != r.URL.RequestURI() || params["opaque"] != "0p4que" || params["qop"] != qop {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("ok " + string(body)))
+	}))
+}
+
+func TestDigestAuthWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestDigestAuthWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestDigestAuthWithLocalServer test")
+	}
+
+	tests := []struct {
+		algorithm, qop string
+	}{
+		{"MD5", "auth"},
+		{"MD5-sess", "auth"},
+		{"SHA-256", "auth"},
+		{"SHA-256", "auth-int"},
+	}
+
+	for _, tc := range tests {
+		var received []string
+		ts := newDigestTestServer(tc.algorithm, tc.qop, &received)
+
+		args := Args{
+			PluginInputParams: PluginInputParams{
+				Url:               ts.URL + "/outlets/4?state=on",
+				HttpMethod:        "POST",
+				RequestBody:       `{"power":"cycle"}`,
+				AuthDigest:        "admin:pa:ss",
+				ValidResponseBody: `ok {"power":"cycle"}`,
+				Quiet:             true,
+			},
+		}
+
+		err := Exec(context.Background(), args)
+		if err != nil {
+			t.Errorf("%s %s: Exec() returned an error: %v", tc.algorithm, tc.qop, err)
+		}
+
+		// unauthenticated, stale nonce, fresh nonce
+		if len(received) != 3 || received[0] != "" || !strings.Contains(received[2], `nonce="nonce-2"`) {
+			t.Errorf("%s %s: unexpected authorization headers %q", tc.algorithm, tc.qop, received)
+		}
+
+		args.AuthDigest = "admin:wrong"
+		if err := Exec(context.Background(), args); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("%s %s: expected a wrong password to fail with 401, got %v", tc.algorithm, tc.qop, err)
+		}
+
+		ts.Close()
+	}
+}
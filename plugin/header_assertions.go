@@ -0,0 +1,193 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HeaderAssertion is a single assert_headers entry
+//
+//	X-Request-Id                      header is present
+//	!Server                           header is absent
+//	X-Deploy-Version = 1.2.0          a value equals
+//	X-Cache != MISS                   no value equals
+//	Content-Type ~ ^application/json  a value matches
+//	Server !~ nginx/1\.1[0-8]         no value matches
+//
+// Header names are case insensitive. A header that was sent several
+// times, or as a comma separated list, passes an equality check when
+// any single value or the joined value is equal.
+type HeaderAssertion struct {
+	Expr     string
+	Name     string
+	Operator string
+	Value    string
+	regex    *regexp.Regexp
+}
+
+var headerAssertionOperators = []string{"!~", "!=", "~", "="}
+
+func ParseHeaderAssertion(expr string) (*HeaderAssertion, error) {
+
+	expr = strings.TrimSpace(expr)
+	ha := &HeaderAssertion{Expr: expr}
+
+	rest := expr
+	if strings.HasPrefix(rest, "!") {
+		ha.Operator = "!"
+		rest = strings.TrimSpace(rest[1:])
+	}
+
+	end := strings.IndexAny(rest, " \t!=~")
+	if end < 0 {
+		end = len(rest)
+	}
+	ha.Name = rest[:end]
+	rest = strings.TrimSpace(rest[end:])
+
+	if ha.Name == "" {
+		return nil, errors.New("missing header name in header assertion: " + expr)
+	}
+
+	if rest == "" {
+		return ha, nil
+	}
+
+	if ha.Operator == "!" {
+		return nil, errors.New("absence assertion takes no value: " + expr)
+	}
+
+	for _, operator := range headerAssertionOperators {
+		if strings.HasPrefix(rest, operator) {
+			ha.Operator = operator
+			ha.Value = strings.TrimSpace(rest[len(operator):])
+			break
+		}
+	}
+
+	switch ha.Operator {
+	case "":
+		return nil, errors.New("unknown operator in header assertion: " + expr)
+	case "~", "!~":
+		var err error
+		ha.regex, err = regexp.Compile(ha.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in header assertion %s: %v", expr, err)
+		}
+	}
+
+	return ha, nil
+}
+
+func (ha *HeaderAssertion) Check(header http.Header) error {
+
+	values := header.Values(ha.Name)
+
+	switch ha.Operator {
+	case "":
+		if len(values) == 0 {
+			return errors.New("header not present")
+		}
+		return nil
+	case "!":
+		if len(values) > 0 {
+			return errors.New("header present: " + strings.Join(values, ","))
+		}
+		return nil
+	}
+
+	if len(values) == 0 {
+		return errors.New("header not present")
+	}
+
+	candidates := headerCandidateValues(values)
+
+	var isMatch bool
+	for _, candidate := range candidates {
+		if ha.regex != nil {
+			isMatch = ha.regex.MatchString(candidate)
+		} else {
+			isMatch = candidate == ha.Value
+		}
+		if isMatch {
+			break
+		}
+	}
+
+	isNegated := ha.Operator == "!=" || ha.Operator == "!~"
+	if isMatch == isNegated {
+		return errors.New("actual: " + strings.Join(values, ","))
+	}
+
+	return nil
+}
+
+// headerCandidateValues returns the joined value, every individual
+// value and every element of comma separated values.
+func headerCandidateValues(values []string) []string {
+
+	candidates := []string{strings.Join(values, ", ")}
+
+	for _, value := range values {
+		candidates = append(candidates, strings.TrimSpace(value))
+		if strings.Contains(value, ",") {
+			for _, element := range strings.Split(value, ",") {
+				candidates = append(candidates, strings.TrimSpace(element))
+			}
+		}
+	}
+
+	return candidates
+}
+
+func (p *Plugin) ValidateHeaderAssertions() error {
+
+	p.headerAssertions = nil
+
+	for _, expr := range SplitSettingList(p.AssertHeaders) {
+		assertion, err := ParseHeaderAssertion(expr)
+		if err != nil {
+			return err
+		}
+		p.headerAssertions = append(p.headerAssertions, assertion)
+	}
+
+	return nil
+}
+
+func (p *Plugin) CheckResponseHeaders() error {
+
+	if len(p.headerAssertions) == 0 {
+		return nil
+	}
+
+	if p.httpResponse == nil {
+		return errors.New("CheckResponseHeaders http response is nil")
+	}
+
+	var failures []string
+
+	for _, assertion := range p.headerAssertions {
+		err := assertion.Check(p.httpResponse.Header)
+		if err != nil {
+			LogPrintf(p, "assert_headers FAIL %s (%s)\n", assertion.Expr, err.Error())
+			failures = append(failures, fmt.Sprintf("%s (%s)", assertion.Expr, err.Error()))
+			continue
+		}
+		LogPrintf(p, "assert_headers PASS %s\n", assertion.Expr)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d header assertions failed:\n  %s",
+			len(failures), len(p.headerAssertions), strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
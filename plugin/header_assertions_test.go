@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderAssertions(t *testing.T) {
+
+	_, found := enableTests["TestHeaderAssertions"]
+	if !found {
+		t.Skip("Skipping TestHeaderAssertions test")
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("X-Deploy-Version", "1.2.0")
+	header.Add("Cache-Control", "public, max-age=600")
+	header.Add("Vary", "Accept")
+	header.Add("Vary", "Origin")
+
+	tests := []struct {
+		expr     string
+		wantPass bool
+	}{
+		{expr: "content-type", wantPass: true},
+		{expr: "X-Missing", wantPass: false},
+		{expr: "!Server", wantPass: true},
+		{expr: "!x-deploy-version", wantPass: false},
+		{expr: "Content-Type ~ ^application/json", wantPass: true},
+		{expr: "Content-Type ~ ^text/", wantPass: false},
+		{expr: "Content-Type !~ ^text/", wantPass: true},
+		{expr: "X-Deploy-Version = 1.2.0", wantPass: true},
+		{expr: "X-Deploy-Version=1.2.1", wantPass: false},
+		{expr: "X-Deploy-Version != 1.2.1", wantPass: true},
+		{expr: "Cache-Control = max-age=600", wantPass: true},
+		{expr: "Vary = Origin", wantPass: true},
+		{expr: "Vary = Accept, Origin", wantPass: true},
+		{expr: "Vary != Origin", wantPass: false},
+		{expr: "X-Missing = value", wantPass: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			assertion, err := ParseHeaderAssertion(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseHeaderAssertion(%q) returned an error: %v", tc.expr, err)
+			}
+			err = assertion.Check(header)
+			if tc.wantPass && err != nil {
+				t.Errorf("Expected %q to pass, but got: %v", tc.expr, err)
+			}
+			if !tc.wantPass && err == nil {
+				t.Errorf("Expected %q to fail, but it passed", tc.expr)
+			}
+		})
+	}
+
+	for _, expr := range []string{"= value", "!Server = x", "Content-Type ~ (", "Content-Type > 1"} {
+		if _, err := ParseHeaderAssertion(expr); err == nil {
+			t.Errorf("Expected ParseHeaderAssertion(%q) to fail", expr)
+		}
+	}
+}
+
+func TestHeaderAssertionsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestHeaderAssertionsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestHeaderAssertionsWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000")
+		w.Header().Set("Server", "nginx")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:           ts.URL,
+			HttpMethod:    "GET",
+			AssertHeaders: "Strict-Transport-Security ~ max-age=\\d+\n!Server",
+			Quiet:         true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected header assertions to fail, but Run() returned no error")
+	}
+
+	if !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "!Server (header present: nginx)") {
+		t.Errorf("Expected a per assertion report, got: %v", err)
+	}
+}
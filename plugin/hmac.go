@@ -0,0 +1,155 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultHmacHeader          = "X-Signature"
+	DefaultHmacTimestampHeader = "X-Timestamp"
+
+	HmacSignBody              = "body"
+	HmacSignTimestampBody     = "timestamp+body"
+	HmacSignMethodPathBody    = "method+path+body"
+	HmacPresetGithub          = "github"
+	githubSignatureHeader     = "X-Hub-Signature-256"
+	githubSignatureAlgorithm  = "sha256"
+	githubSignatureBodyPrefix = "sha256="
+)
+
+/*
+	hmac_signing_string selects the bytes that are signed
+
+	body               the request body
+	timestamp+body     <unix timestamp>.<request body>
+	method+path+body   <METHOD>\n<path?query>\n<request body>
+
+	The timestamp goes into hmac_timestamp_header, X-Timestamp by
+	default, whenever it is signed. The signature is sent hex encoded in
+	hmac_header. The github preset sends sha256=<hex> of the body in
+	X-Hub-Signature-256, like GitHub webhooks do.
+*/
+
+type HmacSigner struct {
+	NewHash         func() hash.Hash
+	Header          string
+	SigningString   string
+	TimestampHeader string
+	Prefix          string
+}
+
+// ValidateHmac builds the signer for hmac_secret.
+func (p *Plugin) ValidateHmac() error {
+
+	p.hmacSigner = nil
+
+	if p.HmacSecret == "" {
+		return nil
+	}
+
+	signer := &HmacSigner{
+		Header:          p.HmacHeader,
+		SigningString:   strings.ToLower(p.HmacSigningString),
+		TimestampHeader: p.HmacTimestampHeader,
+	}
+	algorithm := strings.ToLower(p.HmacAlgorithm)
+
+	switch strings.ToLower(p.HmacPreset) {
+	case "":
+	case HmacPresetGithub:
+		if algorithm != "" && algorithm != githubSignatureAlgorithm {
+			return errors.New("the github hmac_preset signs with sha256 only")
+		}
+		if signer.SigningString != "" && signer.SigningString != HmacSignBody {
+			return errors.New("the github hmac_preset signs the body only")
+		}
+		algorithm = githubSignatureAlgorithm
+		signer.Prefix = githubSignatureBodyPrefix
+		if signer.Header == "" {
+			signer.Header = githubSignatureHeader
+		}
+	default:
+		return errors.New("unknown hmac_preset " + p.HmacPreset)
+	}
+
+	switch algorithm {
+	case "sha1":
+		signer.NewHash = sha1.New
+	case "", "sha256":
+		signer.NewHash = sha256.New
+	case "sha512":
+		signer.NewHash = sha512.New
+	default:
+		return errors.New("invalid hmac_algorithm " + p.HmacAlgorithm + ", expected sha1, sha256 or sha512")
+	}
+
+	switch signer.SigningString {
+	case "":
+		signer.SigningString = HmacSignBody
+	case HmacSignBody, HmacSignMethodPathBody:
+	case HmacSignTimestampBody:
+		if signer.TimestampHeader == "" {
+			signer.TimestampHeader = DefaultHmacTimestampHeader
+		}
+	default:
+		return errors.New("invalid hmac_signing_string " + p.HmacSigningString +
+			", expected body, timestamp+body or method+path+body")
+	}
+
+	if signer.Header == "" {
+		signer.Header = DefaultHmacHeader
+	}
+
+	p.hmacSigner = signer
+	return nil
+}
+
+// SetHmacSignature signs the request body as it is sent, a fresh
+// timestamp is used for every attempt.
+func (p *Plugin) SetHmacSignature() error {
+
+	signer := p.hmacSigner
+	if signer == nil {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetHmacSignature http request is nil")
+	}
+
+	mac := hmac.New(signer.NewHash, []byte(p.HmacSecret))
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if signer.TimestampHeader != "" {
+		p.HttpReq.Header.Set(signer.TimestampHeader, timestamp)
+	}
+
+	switch signer.SigningString {
+	case HmacSignTimestampBody:
+		mac.Write([]byte(timestamp + "."))
+	case HmacSignMethodPathBody:
+		mac.Write([]byte(p.HttpReq.Method + "\n" + p.HttpReq.URL.RequestURI() + "\n"))
+	}
+
+	err := p.HashRequestBody(mac)
+	if err != nil {
+		return err
+	}
+
+	p.HttpReq.Header.Set(signer.Header, signer.Prefix+hex.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
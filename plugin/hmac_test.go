@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHmacSignatureWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestHmacSignatureWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestHmacSignatureWithLocalServer test")
+	}
+
+	var signed []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		newHash := map[string]func() hash.Hash{"sha1": sha1.New, "sha256": sha256.New, "sha512": sha512.New}[r.URL.Query().Get("alg")]
+		header, expectedPrefix := "X-Signature", ""
+
+		var message []byte
+		switch r.URL.Path {
+		case "/github":
+			header, expectedPrefix = "X-Hub-Signature-256", "sha256="
+			message = body
+		case "/body":
+			message = body
+		case "/timestamp":
+			message = append([]byte(r.Header.Get("X-Timestamp")+"."), body...)
+		case "/method":
+			message = append([]byte(r.Method+"\n"+r.URL.RequestURI()+"\n"), body...)
+		}
+
+		mac := hmac.New(newHash, []byte("It's a Secret to Everybody"))
+		mac.Write(message)
+		signature := r.Header.Get(header)
+		signed = append(signed, signature)
+
+		if !hmac.Equal([]byte(signature), []byte(expectedPrefix+hex.EncodeToString(mac.Sum(nil)))) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		params PluginInputParams
+	}{
+		{"github", PluginInputParams{Url: ts.URL + "/github?alg=sha256", HmacPreset: "github"}},
+		{"sha1 body", PluginInputParams{Url: ts.URL + "/body?alg=sha1", HmacAlgorithm: "sha1"}},
+		{"timestamp", PluginInputParams{Url: ts.URL + "/timestamp?alg=sha256", HmacSigningString: "timestamp+body"}},
+		{"method path", PluginInputParams{Url: ts.URL + "/method?alg=sha512", HmacAlgorithm: "sha512", HmacSigningString: "method+path+body"}},
+	}
+
+	for _, tc := range tests {
+		tc.params.HttpMethod = "POST"
+		tc.params.RequestBody = "Hello, World!"
+		tc.params.HmacSecret = "It's a Secret to Everybody"
+		tc.params.Quiet = true
+		err := Exec(context.Background(), Args{PluginInputParams: tc.params})
+		if err != nil {
+			t.Errorf("%s: Exec() returned an error: %v", tc.name, err)
+		}
+	}
+
+	// the signature from the GitHub webhook documentation
+	if signed[0] != "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17" {
+		t.Errorf("Unexpected github signature %s", signed[0])
+	}
+
+	uploadFile := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(uploadFile, []byte(`{"event":"deploy"}`), 0644); err != nil {
+		t.Fatalf("Failed to write upload file: %v", err)
+	}
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:        ts.URL + "/body?alg=sha256",
+			HttpMethod: "POST",
+			UploadFile: uploadFile,
+			HmacSecret: "It's a Secret to Everybody",
+			Quiet:      true,
+		},
+	}
+	if err := Exec(context.Background(), args); err != nil {
+		t.Errorf("Exec() with an upload file returned an error: %v", err)
+	}
+
+	invalid := []PluginInputParams{
+		{HmacSecret: "s", HmacAlgorithm: "md5"},
+		{HmacSecret: "s", HmacSigningString: "path"},
+		{HmacSecret: "s", HmacPreset: "gitlab"},
+		{HmacSecret: "s", HmacPreset: "github", HmacAlgorithm: "sha1"},
+	}
+	for _, params := range invalid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
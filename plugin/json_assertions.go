@@ -0,0 +1,246 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// operators are matched longest first so that >= is not read as >
+var jsonAssertionOperators = []string{"==", "!=", ">=", "<=", "=~", "!~", ">", "<"}
+
+// JsonAssertion is a single assert_json entry such as
+//
+//	$.status == "UP"
+//	$.items.length() > 0
+//	$.version =~ ^1\.
+//
+// An entry without an operator only asserts that the path exists.
+// When the path contains a wildcard every selected value must pass.
+type JsonAssertion struct {
+	Expr     string
+	Path     *JsonPath
+	Operator string
+	Expected interface{}
+	regex    *regexp.Regexp
+}
+
+func ParseJsonAssertion(expr string) (*JsonAssertion, error) {
+
+	expr = strings.TrimSpace(expr)
+	pathStr, operator, operand := splitJsonAssertion(expr)
+
+	path, err := ParseJsonPath(pathStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ja := &JsonAssertion{Expr: expr, Path: path, Operator: operator}
+
+	switch operator {
+	case "":
+	case "=~", "!~":
+		ja.regex, err = regexp.Compile(operand)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in json assertion %s: %v", expr, err)
+		}
+	default:
+		if operand == "" {
+			return nil, errors.New("missing value in json assertion: " + expr)
+		}
+		ja.Expected = parseJsonLiteral(operand)
+	}
+
+	return ja, nil
+}
+
+// splitJsonAssertion finds the first operator that is not inside a
+// bracket or a quoted member name.
+func splitJsonAssertion(expr string) (string, string, string) {
+
+	depth := 0
+	var quote byte
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		case c == '[':
+			depth++
+			continue
+		case c == ']':
+			depth--
+			continue
+		}
+
+		if depth > 0 {
+			continue
+		}
+
+		for _, operator := range jsonAssertionOperators {
+			if strings.HasPrefix(expr[i:], operator) {
+				return strings.TrimSpace(expr[:i]), operator, strings.TrimSpace(expr[i+len(operator):])
+			}
+		}
+	}
+
+	return expr, "", ""
+}
+
+// parseJsonLiteral reads the right hand side of a comparison as JSON,
+// falling back to a plain string so that $.status == UP also works.
+func parseJsonLiteral(operand string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(operand), &value); err != nil {
+		return operand
+	}
+	return value
+}
+
+// Check returns nil when the assertion holds for doc, otherwise an
+// error describing the value that was actually found.
+func (ja *JsonAssertion) Check(doc interface{}) error {
+
+	values := ja.Path.Evaluate(doc)
+	if len(values) == 0 {
+		return errors.New("path not found")
+	}
+
+	if ja.Operator == "" {
+		return nil
+	}
+
+	for _, value := range values {
+		ok, err := ja.compare(value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("actual: " + jsonString(value))
+		}
+	}
+
+	return nil
+}
+
+func (ja *JsonAssertion) compare(value interface{}) (bool, error) {
+
+	switch ja.Operator {
+	case "==":
+		return reflect.DeepEqual(value, ja.Expected), nil
+	case "!=":
+		return !reflect.DeepEqual(value, ja.Expected), nil
+	case "=~":
+		return ja.regex.MatchString(plainString(value)), nil
+	case "!~":
+		return !ja.regex.MatchString(plainString(value)), nil
+	}
+
+	switch actual := value.(type) {
+	case float64:
+		expected, ok := ja.Expected.(float64)
+		if !ok {
+			return false, errors.New("cannot compare number " + jsonString(value) + " with " + jsonString(ja.Expected))
+		}
+		return compareOrdered(ja.Operator, actual < expected, actual == expected), nil
+	case string:
+		expected, ok := ja.Expected.(string)
+		if !ok {
+			return false, errors.New("cannot compare string " + jsonString(value) + " with " + jsonString(ja.Expected))
+		}
+		return compareOrdered(ja.Operator, actual < expected, actual == expected), nil
+	}
+
+	return false, errors.New("cannot order value " + jsonString(value))
+}
+
+func compareOrdered(operator string, isLess, isEqual bool) bool {
+	switch operator {
+	case ">":
+		return !isLess && !isEqual
+	case ">=":
+		return !isLess
+	case "<":
+		return isLess
+	case "<=":
+		return isLess || isEqual
+	}
+	return false
+}
+
+// plainString is used for regex matches, strings are matched as is
+// and everything else against its JSON encoding.
+func plainString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return jsonString(value)
+}
+
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func (p *Plugin) ValidateJsonAssertions() error {
+
+	p.jsonAssertions = nil
+
+	for _, expr := range SplitSettingList(p.AssertJson) {
+		assertion, err := ParseJsonAssertion(expr)
+		if err != nil {
+			return err
+		}
+		p.jsonAssertions = append(p.jsonAssertions, assertion)
+	}
+
+	return nil
+}
+
+func (p *Plugin) CheckJsonAssertions() error {
+
+	if len(p.jsonAssertions) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(p.httpResponseBodyBytes, &doc); err != nil {
+		return errors.New("assert_json: response body is not valid json: " + err.Error())
+	}
+
+	var failures []string
+
+	for _, assertion := range p.jsonAssertions {
+		err := assertion.Check(doc)
+		if err != nil {
+			LogPrintf(p, "assert_json FAIL %s (%s)\n", assertion.Expr, err.Error())
+			failures = append(failures, fmt.Sprintf("%s (%s)", assertion.Expr, err.Error()))
+			continue
+		}
+		LogPrintf(p, "assert_json PASS %s\n", assertion.Expr)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d json assertions failed:\n  %s",
+			len(failures), len(p.jsonAssertions), strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
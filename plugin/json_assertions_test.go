@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const jsonAssertionTestBody = `{
+	"status": "UP",
+	"version": "1.4.2",
+	"items": [{"name": "a", "ready": true}, {"name": "b", "ready": true}],
+	"meta": {"count": 2, "key with space": "x"}
+}`
+
+func TestJsonAssertions(t *testing.T) {
+
+	_, found := enableTests["TestJsonAssertions"]
+	if !found {
+		t.Skip("Skipping TestJsonAssertions test")
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(jsonAssertionTestBody), &doc); err != nil {
+		t.Fatalf("Failed to decode test body: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		wantPass bool
+	}{
+		{expr: `$.status == "UP"`, wantPass: true},
+		{expr: `$.status == UP`, wantPass: true},
+		{expr: `$.status != "DOWN"`, wantPass: true},
+		{expr: `$.items.length() > 0`, wantPass: true},
+		{expr: `$.items.length() >= 3`, wantPass: false},
+		{expr: `$.version =~ ^1\.`, wantPass: true},
+		{expr: `$.version !~ ^2\.`, wantPass: true},
+		{expr: `$.items[0].name == "a"`, wantPass: true},
+		{expr: `$.items[-1].name == "b"`, wantPass: true},
+		{expr: `$.items[*].ready == true`, wantPass: true},
+		{expr: `$.items[*].name == "a"`, wantPass: false},
+		{expr: `$.meta.count <= 2`, wantPass: true},
+		{expr: `$.meta['key with space'] == "x"`, wantPass: true},
+		{expr: `$.meta`, wantPass: true},
+		{expr: `$.missing`, wantPass: false},
+		{expr: `$.status > 1`, wantPass: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			assertion, err := ParseJsonAssertion(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseJsonAssertion(%q) returned an error: %v", tc.expr, err)
+			}
+			err = assertion.Check(doc)
+			if tc.wantPass && err != nil {
+				t.Errorf("Expected %q to pass, but got: %v", tc.expr, err)
+			}
+			if !tc.wantPass && err == nil {
+				t.Errorf("Expected %q to fail, but it passed", tc.expr)
+			}
+		})
+	}
+
+	for _, expr := range []string{`status == "UP"`, `$.items[`, `$.version =~ (`, `$.status ==`, `$.a.length().b`} {
+		if _, err := ParseJsonAssertion(expr); err == nil {
+			t.Errorf("Expected ParseJsonAssertion(%q) to fail", expr)
+		}
+	}
+}
+
+func TestJsonAssertionsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestJsonAssertionsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestJsonAssertionsWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, ApplicationJson)
+		w.Write([]byte(jsonAssertionTestBody))
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:        ts.URL,
+			HttpMethod: "GET",
+			AssertJson: "$.status == \"UP\"\n$.items.length() > 5\n$.version =~ ^2\\.",
+			Quiet:      true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected json assertions to fail, but Run() returned no error")
+	}
+
+	if !strings.Contains(err.Error(), "2 of 3") ||
+		!strings.Contains(err.Error(), "$.items.length() > 5 (actual: 2)") ||
+		!strings.Contains(err.Error(), `$.version =~ ^2\. (actual: "1.4.2")`) {
+		t.Errorf("Expected a per assertion report, got: %v", err)
+	}
+
+	plugin = GetNewPlugin(args)
+	plugin.AssertJson = `$.status == "UP",$.items[*].ready == true`
+	err = plugin.Run()
+	defer plugin.DeInit()
+
+	if err != nil {
+		t.Fatalf("Run() returned an error: %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	Validates response bodies against a subset of JSON Schema draft 2020-12
+
+	core          $ref (local #/... only), $defs, definitions, true / false schemas
+	applicators   allOf, anyOf, oneOf, not, properties, additionalProperties,
+	              items, prefixItems
+	validation    type, enum, const, required, pattern, minLength, maxLength,
+	              minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+	              multipleOf, minItems, maxItems, uniqueItems,
+	              minProperties, maxProperties
+
+	Unknown keywords are ignored, as the specification requires.
+*/
+
+type JsonSchema struct {
+	Path    string
+	root    interface{}
+	regexes map[string]*regexp.Regexp
+}
+
+func LoadJsonSchema(path string) (*JsonSchema, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("schema %s is not valid json: %v", path, err)
+	}
+
+	js := &JsonSchema{Path: path, root: root, regexes: map[string]*regexp.Regexp{}}
+	if err := js.compilePatterns(root); err != nil {
+		return nil, err
+	}
+
+	return js, nil
+}
+
+// compilePatterns walks the whole schema so that a bad pattern is
+// reported when the plugin starts rather than after the request.
+func (js *JsonSchema) compilePatterns(node interface{}) error {
+
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if pattern, ok := child.(string); ok && key == "pattern" {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Errorf("invalid pattern %q in schema %s: %v", pattern, js.Path, err)
+				}
+				js.regexes[pattern] = re
+				continue
+			}
+			if err := js.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := js.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate returns one entry per violation, each prefixed with the
+// JSON pointer of the offending value.
+func (js *JsonSchema) Validate(doc interface{}) []string {
+	var violations []string
+	js.validate(js.root, doc, "", &violations, 0)
+	return violations
+}
+
+func (js *JsonSchema) validate(schema interface{}, value interface{}, pointer string, violations *[]string, depth int) {
+
+	report := func(format string, args ...interface{}) {
+		*violations = append(*violations, "#"+pointer+": "+fmt.Sprintf(format, args...))
+	}
+
+	if depth > 64 {
+		report("schema nesting too deep, possible $ref cycle")
+		return
+	}
+
+	if isAllowed, ok := schema.(bool); ok {
+		if !isAllowed {
+			report("no value is allowed here")
+		}
+		return
+	}
+
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := js.resolveRef(ref)
+		if err != nil {
+			report("%s", err.Error())
+		} else {
+			js.validate(target, value, pointer, violations, depth+1)
+		}
+	}
+
+	if types, ok := s["type"]; ok && !matchesSchemaType(types, value) {
+		report("expected type %s, got %s", jsonString(types), jsonSchemaTypeOf(value))
+		return
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		isFound := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			report("value %s is not one of %s", jsonString(value), jsonString(enum))
+		}
+	}
+
+	if constValue, ok := s["const"]; ok && !reflect.DeepEqual(constValue, value) {
+		report("value %s is not %s", jsonString(value), jsonString(constValue))
+	}
+
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		subSchemas, ok := s[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		passed := 0
+		for _, subSchema := range subSchemas {
+			var subViolations []string
+			js.validate(subSchema, value, pointer, &subViolations, depth+1)
+			if len(subViolations) == 0 {
+				passed++
+			} else if keyword == "allOf" {
+				*violations = append(*violations, subViolations...)
+			}
+		}
+		if keyword == "anyOf" && passed == 0 {
+			report("value does not match any schema in anyOf")
+		}
+		if keyword == "oneOf" && passed != 1 {
+			report("value matches %d schemas in oneOf, expected exactly 1", passed)
+		}
+	}
+
+	if notSchema, ok := s["not"]; ok {
+		var subViolations []string
+		js.validate(notSchema, value, pointer, &subViolations, depth+1)
+		if len(subViolations) == 0 {
+			report("value must not match the schema in not")
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		js.validateString(s, v, report)
+	case float64:
+		validateNumber(s, v, report)
+	case []interface{}:
+		js.validateArray(s, v, pointer, violations, depth, report)
+	case map[string]interface{}:
+		js.validateObject(s, v, pointer, violations, depth, report)
+	}
+}
+
+func (js *JsonSchema) validateString(s map[string]interface{}, value string, report func(string, ...interface{})) {
+
+	length := float64(len([]rune(value)))
+
+	if minLength, ok := s["minLength"].(float64); ok && length < minLength {
+		report("string is shorter than minLength %v", minLength)
+	}
+
+	if maxLength, ok := s["maxLength"].(float64); ok && length > maxLength {
+		report("string is longer than maxLength %v", maxLength)
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		if re := js.regexes[pattern]; re != nil && !re.MatchString(value) {
+			report("string %q does not match pattern %s", value, pattern)
+		}
+	}
+}
+
+func validateNumber(s map[string]interface{}, value float64, report func(string, ...interface{})) {
+
+	if minimum, ok := s["minimum"].(float64); ok && value < minimum {
+		report("%v is less than minimum %v", value, minimum)
+	}
+
+	if maximum, ok := s["maximum"].(float64); ok && value > maximum {
+		report("%v is greater than maximum %v", value, maximum)
+	}
+
+	if minimum, ok := s["exclusiveMinimum"].(float64); ok && value <= minimum {
+		report("%v is not greater than exclusiveMinimum %v", value, minimum)
+	}
+
+	if maximum, ok := s["exclusiveMaximum"].(float64); ok && value >= maximum {
+		report("%v is not less than exclusiveMaximum %v", value, maximum)
+	}
+
+	if multipleOf, ok := s["multipleOf"].(float64); ok && multipleOf > 0 {
+		quotient := value / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			report("%v is not a multiple of %v", value, multipleOf)
+		}
+	}
+}
+
+func (js *JsonSchema) validateArray(s map[string]interface{}, value []interface{}, pointer string,
+	violations *[]string, depth int, report func(string, ...interface{})) {
+
+	length := float64(len(value))
+
+	if minItems, ok := s["minItems"].(float64); ok && length < minItems {
+		report("array has %d items, fewer than minItems %v", len(value), minItems)
+	}
+
+	if maxItems, ok := s["maxItems"].(float64); ok && length > maxItems {
+		report("array has %d items, more than maxItems %v", len(value), maxItems)
+	}
+
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					report("items %d and %d are equal but uniqueItems is set", j, i)
+				}
+			}
+		}
+	}
+
+	prefixItems, _ := s["prefixItems"].([]interface{})
+	for i, item := range value {
+		itemPointer := pointer + "/" + strconv.Itoa(i)
+		if i < len(prefixItems) {
+			js.validate(prefixItems[i], item, itemPointer, violations, depth+1)
+			continue
+		}
+		if items, ok := s["items"]; ok {
+			js.validate(items, item, itemPointer, violations, depth+1)
+		}
+	}
+}
+
+func (js *JsonSchema) validateObject(s map[string]interface{}, value map[string]interface{}, pointer string,
+	violations *[]string, depth int, report func(string, ...interface{})) {
+
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, name := range required {
+			if nameStr, ok := name.(string); ok {
+				if _, found := value[nameStr]; !found {
+					*violations = append(*violations,
+						"#"+pointer+"/"+escapeJsonPointer(nameStr)+": required property is missing")
+				}
+			}
+		}
+	}
+
+	if minProperties, ok := s["minProperties"].(float64); ok && float64(len(value)) < minProperties {
+		report("object has fewer than minProperties %v", minProperties)
+	}
+
+	if maxProperties, ok := s["maxProperties"].(float64); ok && float64(len(value)) > maxProperties {
+		report("object has more than maxProperties %v", maxProperties)
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+
+	for _, name := range sortedKeys(value) {
+		propertyPointer := pointer + "/" + escapeJsonPointer(name)
+		if propertySchema, ok := properties[name]; ok {
+			js.validate(propertySchema, value[name], propertyPointer, violations, depth+1)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if isAllowed, ok := additional.(bool); ok && !isAllowed {
+			*violations = append(*violations, "#"+propertyPointer+": additional property is not allowed")
+			continue
+		}
+		js.validate(additional, value[name], propertyPointer, violations, depth+1)
+	}
+}
+
+func (js *JsonSchema) resolveRef(ref string) (interface{}, error) {
+
+	if ref == "#" {
+		return js.root, nil
+	}
+
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, errors.New("unsupported $ref " + ref + ", only local references are supported")
+	}
+
+	node := js.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("unresolvable $ref " + ref)
+		}
+		node, ok = obj[token]
+		if !ok {
+			return nil, errors.New("unresolvable $ref " + ref)
+		}
+	}
+
+	return node, nil
+}
+
+func matchesSchemaType(types interface{}, value interface{}) bool {
+
+	switch t := types.(type) {
+	case string:
+		return matchesSingleSchemaType(t, value)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && matchesSingleSchemaType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func matchesSingleSchemaType(name string, value interface{}) bool {
+	actual := jsonSchemaTypeOf(value)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+func jsonSchemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func escapeJsonPointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func (p *Plugin) ValidateResponseSchema() error {
+
+	p.responseSchema = nil
+
+	if p.ResponseSchema == "" {
+		return nil
+	}
+
+	schema, err := LoadJsonSchema(p.ResponseSchema)
+	if err != nil {
+		return err
+	}
+
+	p.responseSchema = schema
+	return nil
+}
+
+func (p *Plugin) CheckResponseSchema() error {
+
+	if p.responseSchema == nil {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(p.httpResponseBodyBytes, &doc); err != nil {
+		return errors.New("response_schema: response body is not valid json: " + err.Error())
+	}
+
+	violations := p.responseSchema.Validate(doc)
+	if len(violations) > 0 {
+		for _, violation := range violations {
+			LogPrintln(p, "response_schema FAIL", violation)
+		}
+		return fmt.Errorf("response does not match schema %s, %d violations:\n  %s",
+			p.ResponseSchema, len(violations), strings.Join(violations, "\n  "))
+	}
+
+	LogPrintln(p, "response_schema PASS", p.ResponseSchema)
+	return nil
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const jsonSchemaTestSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["id", "status", "tags"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"status": {"enum": ["UP", "DOWN"]},
+		"version": {"type": "string", "pattern": "^\\d+\\.\\d+\\.\\d+$"},
+		"name": {"type": "string", "minLength": 2, "maxLength": 8},
+		"tags": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/tag"}},
+		"a/b": {"type": "boolean"}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"tag": {"type": "object", "required": ["key"], "properties": {"key": {"type": "string"}}}
+	}
+}`
+
+func writeJsonSchemaTestFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(jsonSchemaTestSchema), 0644); err != nil {
+		t.Fatalf("Failed to write schema file: %v", err)
+	}
+	return path
+}
+
+func TestJsonSchemaValidation(t *testing.T) {
+
+	_, found := enableTests["TestJsonSchemaValidation"]
+	if !found {
+		t.Skip("Skipping TestJsonSchemaValidation test")
+	}
+
+	schema, err := LoadJsonSchema(writeJsonSchemaTestFile(t))
+	if err != nil {
+		t.Fatalf("LoadJsonSchema() returned an error: %v", err)
+	}
+
+	var doc interface{}
+	jsonUnmarshalForTest(t, `{"id": 3, "status": "UP", "version": "1.2.3", "name": "api", "tags": [{"key": "a"}]}`, &doc)
+	if violations := schema.Validate(doc); len(violations) != 0 {
+		t.Errorf("Expected no violations, got: %v", violations)
+	}
+
+	jsonUnmarshalForTest(t, `{"id": 0.5, "status": "BROKEN", "version": "v1", "name": "a-very-long-name",
+		"tags": [{"key": 1}, {}], "a/b": "yes", "extra": true}`, &doc)
+
+	expected := []string{
+		"#/id: expected type \"integer\", got number",
+		"#/status: value \"BROKEN\" is not one of [\"UP\",\"DOWN\"]",
+		"#/version: string \"v1\" does not match pattern",
+		"#/name: string is longer than maxLength 8",
+		"#/tags/0/key: expected type \"string\", got integer",
+		"#/tags/1/key: required property is missing",
+		"#/a~1b: expected type \"boolean\", got string",
+		"#/extra: additional property is not allowed",
+	}
+
+	violations := schema.Validate(doc)
+	joined := strings.Join(violations, "\n")
+	for _, want := range expected {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected violation %q in:\n%s", want, joined)
+		}
+	}
+	if len(violations) != len(expected) {
+		t.Errorf("Expected %d violations, got %d:\n%s", len(expected), len(violations), joined)
+	}
+
+	jsonUnmarshalForTest(t, `[1, 2]`, &doc)
+	violations = schema.Validate(doc)
+	if len(violations) != 1 || violations[0] != `#: expected type "object", got array` {
+		t.Errorf("Expected a single root type violation, got: %v", violations)
+	}
+}
+
+func TestResponseSchemaWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestResponseSchemaWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestResponseSchemaWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, ApplicationJson)
+		w.Write([]byte(`{"id": 7, "status": "UP", "tags": []}`))
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:            ts.URL,
+			HttpMethod:     "GET",
+			ResponseSchema: writeJsonSchemaTestFile(t),
+			Quiet:          true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected schema validation to fail, but Run() returned no error")
+	}
+
+	if !strings.Contains(err.Error(), "#/tags: array has 0 items, fewer than minItems 1") {
+		t.Errorf("Expected the violating pointer in the error, got: %v", err)
+	}
+}
+
+func jsonUnmarshalForTest(t *testing.T, data string, v interface{}) {
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		t.Fatalf("Failed to decode %s: %v", data, err)
+	}
+}
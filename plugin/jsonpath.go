@@ -0,0 +1,176 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/*
+	A small JSONPath subset, enough for asserting on and capturing from
+	API responses without pulling in a dependency.
+
+	$                root of the document
+	.name  ['name']  object member
+	[2]  [-1]        array element, negative indexes count from the end
+	[*]  .*          every element / member value
+	.length()        length of an array, object or string (last segment only)
+*/
+
+type jsonPathSegmentKind int
+
+const (
+	jsonPathMember jsonPathSegmentKind = iota
+	jsonPathIndex
+	jsonPathWildcard
+	jsonPathLength
+)
+
+type jsonPathSegment struct {
+	kind  jsonPathSegmentKind
+	name  string
+	index int
+}
+
+type JsonPath struct {
+	Expr       string
+	segments   []jsonPathSegment
+	isMultiple bool
+}
+
+func ParseJsonPath(expr string) (*JsonPath, error) {
+
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, errors.New("json path must start with $: " + expr)
+	}
+
+	jp := &JsonPath{Expr: expr}
+	rest := expr[1:]
+
+	for len(rest) > 0 {
+		if len(jp.segments) > 0 && jp.segments[len(jp.segments)-1].kind == jsonPathLength {
+			return nil, errors.New("length() must be the last segment of json path: " + expr)
+		}
+
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, "*") {
+				jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathWildcard})
+				jp.isMultiple = true
+				rest = rest[1:]
+				continue
+			}
+			if strings.HasPrefix(rest, "length()") {
+				jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathLength})
+				rest = rest[len("length()"):]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, errors.New("empty member name in json path: " + expr)
+			}
+			jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathMember, name: name})
+			rest = rest[end:]
+
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, errors.New("unterminated [ in json path: " + expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathWildcard})
+				jp.isMultiple = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathMember, name: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, errors.New("invalid index " + inner + " in json path: " + expr)
+				}
+				jp.segments = append(jp.segments, jsonPathSegment{kind: jsonPathIndex, index: index})
+			}
+
+		default:
+			return nil, errors.New("unexpected character " + string(rest[0]) + " in json path: " + expr)
+		}
+	}
+
+	return jp, nil
+}
+
+// IsMultiple reports whether the path contains a wildcard and so
+// may select more than one value.
+func (jp *JsonPath) IsMultiple() bool {
+	return jp.isMultiple
+}
+
+// Evaluate returns every value selected by the path, in document
+// order. An empty result means nothing matched.
+func (jp *JsonPath) Evaluate(doc interface{}) []interface{} {
+
+	nodes := []interface{}{doc}
+
+	for _, segment := range jp.segments {
+		var next []interface{}
+
+		for _, node := range nodes {
+			switch segment.kind {
+			case jsonPathMember:
+				if obj, ok := node.(map[string]interface{}); ok {
+					if value, found := obj[segment.name]; found {
+						next = append(next, value)
+					}
+				}
+
+			case jsonPathIndex:
+				if arr, ok := node.([]interface{}); ok {
+					index := segment.index
+					if index < 0 {
+						index += len(arr)
+					}
+					if index >= 0 && index < len(arr) {
+						next = append(next, arr[index])
+					}
+				}
+
+			case jsonPathWildcard:
+				switch value := node.(type) {
+				case []interface{}:
+					next = append(next, value...)
+				case map[string]interface{}:
+					for _, key := range sortedKeys(value) {
+						next = append(next, value[key])
+					}
+				}
+
+			case jsonPathLength:
+				switch value := node.(type) {
+				case []interface{}:
+					next = append(next, float64(len(value)))
+				case map[string]interface{}:
+					next = append(next, float64(len(value)))
+				case string:
+					next = append(next, float64(len([]rune(value))))
+				}
+			}
+		}
+
+		nodes = next
+	}
+
+	return nodes
+}
@@ -0,0 +1,244 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JwtRS256 = "RS256"
+	JwtES256 = "ES256"
+	JwtHS256 = "HS256"
+
+	DefaultJwtTtl = 5 * time.Minute
+)
+
+/*
+	jwt_private_key is the path of a PEM encoded RSA or P-256 key, or of
+	the shared secret for HS256. The algorithm follows from the key
+	unless jwt_algorithm is set. Every request, retries included, gets a
+	freshly minted token with iat, exp and a random jti, plus jwt_issuer,
+	jwt_audience, jwt_subject and the json object of jwt_claims. With
+	template set, these are rendered as templates like the request body,
+	for jwt_claims only its string values:
+
+	jwt_claims: '{"repo": "{{ .Repo.Slug }}", "build": "{{ .Build.Number }}"}'
+*/
+
+type JwtSigner struct {
+	Algorithm string
+	Key       interface{}
+	Ttl       time.Duration
+	Claims    map[string]interface{}
+}
+
+// ValidateJwt loads the signing key and the claims of the token.
+func (p *Plugin) ValidateJwt() error {
+
+	p.jwtSigner = nil
+
+	if p.JwtPrivateKey == "" {
+		if p.JwtAlgorithm != "" || p.JwtClaims != "" {
+			return errors.New("jwt_private_key is required to mint a jwt")
+		}
+		return nil
+	}
+
+	if p.IsAuthBasic() || p.AuthBearer != "" || p.AuthBearerFile != "" || p.IsOAuth2() ||
+		p.AuthAwsSigv4 || p.AuthDigest != "" || p.AuthNtlm != "" {
+		return errors.New("jwt_private_key cannot be combined with another auth setting")
+	}
+
+	keyData, err := os.ReadFile(p.JwtPrivateKey)
+	if err != nil {
+		return errors.New("cannot read jwt_private_key: " + err.Error())
+	}
+
+	signer := &JwtSigner{
+		Algorithm: strings.ToUpper(p.JwtAlgorithm),
+		Ttl:       DefaultJwtTtl,
+		Claims:    map[string]interface{}{},
+	}
+
+	if signer.Algorithm == JwtHS256 {
+		secret := strings.TrimRight(string(keyData), "\r\n")
+		if secret == "" {
+			return errors.New("jwt_private_key " + p.JwtPrivateKey + " is empty")
+		}
+		signer.Key = []byte(secret)
+	} else {
+		signer.Key, err = parseJwtPrivateKey(keyData)
+		if err != nil {
+			return err
+		}
+		switch key := signer.Key.(type) {
+		case *rsa.PrivateKey:
+			if signer.Algorithm == "" {
+				signer.Algorithm = JwtRS256
+			}
+		case *ecdsa.PrivateKey:
+			if key.Curve != elliptic.P256() {
+				return errors.New("jwt_private_key is not a P-256 key, ES256 needs one")
+			}
+			if signer.Algorithm == "" {
+				signer.Algorithm = JwtES256
+			}
+		default:
+			return errors.New("jwt_private_key is neither an RSA nor an ECDSA key")
+		}
+
+		_, isRsa := signer.Key.(*rsa.PrivateKey)
+		switch {
+		case signer.Algorithm == JwtRS256 && isRsa:
+		case signer.Algorithm == JwtES256 && !isRsa:
+		case signer.Algorithm != JwtRS256 && signer.Algorithm != JwtES256:
+			return errors.New("invalid jwt_algorithm " + p.JwtAlgorithm + ", expected RS256, ES256 or HS256")
+		default:
+			return errors.New("jwt_algorithm " + signer.Algorithm + " does not match the jwt_private_key")
+		}
+	}
+
+	if p.JwtTtl != "" {
+		signer.Ttl, err = ParseDurationSetting(p.JwtTtl)
+		if err != nil || signer.Ttl == 0 {
+			return errors.New("invalid jwt_ttl " + p.JwtTtl)
+		}
+	}
+
+	if p.JwtClaims != "" {
+		if err := json.Unmarshal([]byte(p.JwtClaims), &signer.Claims); err != nil {
+			return errors.New("jwt_claims is not a json object: " + err.Error())
+		}
+	}
+
+	if p.JwtIssuer != "" {
+		signer.Claims["iss"] = p.JwtIssuer
+	}
+	if p.JwtSubject != "" {
+		signer.Claims["sub"] = p.JwtSubject
+	}
+	if audience := SplitSettingList(p.JwtAudience); len(audience) == 1 {
+		signer.Claims["aud"] = audience[0]
+	} else if len(audience) > 1 {
+		signer.Claims["aud"] = audience
+	}
+
+	p.jwtSigner = signer
+	return nil
+}
+
+// SetAuthJwt mints a token for the request and sends it as a bearer
+// token.
+func (p *Plugin) SetAuthJwt() error {
+
+	if p.jwtSigner == nil {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetAuthJwt http request is nil")
+	}
+
+	token, err := p.jwtSigner.Mint(time.Now())
+	if err != nil {
+		return err
+	}
+
+	p.jwtToken = token
+	p.HttpReq.Header.Set(AuthorizationHeader, BearerAuthorization+token)
+
+	return nil
+}
+
+// Mint returns a signed token valid from now for the ttl of the signer.
+func (s *JwtSigner) Mint(now time.Time) (string, error) {
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{}
+	for name, value := range s.Claims {
+		claims[name] = value
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.Ttl).Unix()
+	claims["jti"] = hex.EncodeToString(jti)
+
+	header, err := json.Marshal(map[string]string{"alg": s.Algorithm, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+
+	switch key := s.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+
+	case *ecdsa.PrivateKey:
+		r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", err
+		}
+		// JWS wants the fixed size r || s, not the ASN.1 encoding
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		sig.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parseJwtPrivateKey(data []byte) (interface{}, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt_private_key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	return nil, errors.New("unsupported jwt_private_key PEM block " + block.Type)
+}
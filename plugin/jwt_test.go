@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// verifyTestJwt checks the signature of token with key and returns
+// its claims.
+func verifyTestJwt(token string, key interface{}) (map[string]interface{}, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("bad HS256 signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, err
+		}
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 || !ecdsa.Verify(key, digest[:],
+			new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, errors.New("bad ES256 signature")
+		}
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := map[string]interface{}{}
+	err := json.Unmarshal(payload, &claims)
+
+	return claims, err
+}
+
+func TestJwtWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestJwtWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestJwtWithLocalServer test")
+	}
+
+	dir := t.TempDir()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaFile := filepath.Join(dir, "rsa.pem")
+	os.WriteFile(rsaFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600)
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecBytes, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	ecFile := filepath.Join(dir, "ec.pem")
+	os.WriteFile(ecFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecBytes}), 0600)
+
+	hmacFile := filepath.Join(dir, "secret")
+	os.WriteFile(hmacFile, []byte("sh4red-s3cret\n"), 0600)
+
+	var verifyKey interface{}
+	var claims []map[string]interface{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		tokenClaims, err := verifyTestJwt(token, verifyKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		claims = append(claims, tokenClaims)
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:         ts.URL + "/deploy",
+			HttpMethod:  "POST",
+			RequestBody: "{}",
+			JwtIssuer:   "drone",
+			JwtAudience: "deploy-api",
+			JwtSubject:  "repo:{{ .Repo.Slug }}",
+			JwtTtl:      "90s",
+			JwtClaims:   `{"build": "{{ .Build.Number }}", "ref": "{{ .Commit.Ref }}", "deploy": {"message": "{{ .Commit.Message }}"}}`,
+			Template:    true,
+			Quiet:       true,
+		},
+	}
+	args.Repo.Slug = "octocat/hello-world"
+	args.Build.Number = 42
+	args.Commit.Ref = "refs/heads/main"
+	args.Commit.Message = "Fix \"quoted\" paths\n\nin C:\\drone"
+
+	keys := []struct {
+		file, algorithm string
+		verifyKey       interface{}
+	}{
+		{rsaFile, "", &rsaKey.PublicKey},
+		{ecFile, "", &ecKey.PublicKey},
+		{hmacFile, "HS256", []byte("sh4red-s3cret")},
+	}
+
+	for _, key := range keys {
+		args.JwtPrivateKey = key.file
+		args.JwtAlgorithm = key.algorithm
+		verifyKey = key.verifyKey
+
+		if err := Exec(context.Background(), args); err != nil {
+			t.Fatalf("Exec() with %s returned an error: %v", filepath.Base(key.file), err)
+		}
+	}
+
+	if len(claims) != 3 {
+		t.Fatalf("Expected three verified tokens, got %d", len(claims))
+	}
+	for _, c := range claims {
+		if c["iss"] != "drone" || c["aud"] != "deploy-api" || c["sub"] != "repo:octocat/hello-world" ||
+			c["build"] != "42" || c["ref"] != "refs/heads/main" || c["jti"] == "" ||
+			c["deploy"].(map[string]interface{})["message"] != args.Commit.Message {
+			t.Errorf("Unexpected claims %v", c)
+		}
+		if c["exp"].(float64)-c["iat"].(float64) != 90 {
+			t.Errorf("Expected a 90s ttl, got claims %v", c)
+		}
+	}
+	if claims[0]["jti"] == claims[1]["jti"] {
+		t.Errorf("Expected a new jti for every token")
+	}
+
+	invalid := []PluginInputParams{
+		{JwtPrivateKey: rsaFile, JwtAlgorithm: "ES256"},
+		{JwtPrivateKey: hmacFile},
+		{JwtPrivateKey: rsaFile, JwtAlgorithm: "PS256"},
+		{JwtPrivateKey: rsaFile, JwtClaims: "[1]"},
+		{JwtPrivateKey: rsaFile, JwtTtl: "soon"},
+		{JwtPrivateKey: rsaFile, AuthBearer: "token"},
+		{JwtClaims: `{"a": 1}`},
+	}
+	for _, params := range invalid {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+/*
+	NTLMv2 over http, as IIS and SharePoint speak it. The request is
+	sent with a Negotiate message, the server answers 401 with a
+	Challenge message and the request is sent again with the
+	Authenticate message. The handshake authenticates the connection,
+	so the three requests have to go over the same keep-alive
+	connection, which the transport reuses once the 401 is drained.
+*/
+
+const (
+	ntlmSignature = "NTLMSSP\x00"
+
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOem                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNtlm                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOem | ntlmRequestTarget |
+		ntlmNegotiateNtlm | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity |
+		ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	ntlmAvEol       = 0
+	ntlmAvTimestamp = 7
+)
+
+type NtlmCredentials struct {
+	Domain string
+	User   string
+	Pass   string
+}
+
+// ValidateAuthNtlm splits auth_ntlm, written as domain\user:pass or
+// user:pass, the password may contain colons.
+func (p *Plugin) ValidateAuthNtlm() error {
+
+	p.ntlmCredentials = nil
+
+	if p.AuthNtlm == "" {
+		return nil
+	}
+
+	if p.IsAuthBasic() || p.AuthBearer != "" || p.AuthBearerFile != "" || p.IsOAuth2() || p.AuthAwsSigv4 || p.AuthDigest != "" {
+		return errors.New("auth_ntlm cannot be combined with another auth setting")
+	}
+
+	userPass := strings.SplitN(p.AuthNtlm, ":", 2)
+	if len(userPass) != 2 || userPass[0] == "" {
+		return errors.New("invalid auth_ntlm format, expected domain\\user:pass")
+	}
+
+	credentials := &NtlmCredentials{User: userPass[0], Pass: userPass[1]}
+	if i := strings.Index(credentials.User, `\`); i >= 0 {
+		credentials.Domain, credentials.User = credentials.User[:i], credentials.User[i+1:]
+	}
+	if credentials.User == "" {
+		return errors.New("invalid auth_ntlm format, user is empty")
+	}
+
+	p.ntlmCredentials = credentials
+	return nil
+}
+
+// AnswerNtlmChallenge takes the Challenge message of a 401 response. A
+// 401 to the Authenticate message means the credentials were rejected.
+func (p *Plugin) AnswerNtlmChallenge(resp *http.Response) (bool, error) {
+
+	if p.ntlmAuthenticateSent {
+		return false, nil
+	}
+
+	for _, challenge := range ParseAuthChallenges(resp.Header.Values("WWW-Authenticate")) {
+		if !strings.EqualFold(challenge.Scheme, "NTLM") || challenge.Token == "" {
+			continue
+		}
+		message, err := base64.StdEncoding.DecodeString(challenge.Token)
+		if err != nil {
+			return false, errors.New("invalid ntlm challenge: " + err.Error())
+		}
+		p.ntlmChallenge = message
+		LogPrintln(p, "answering ntlm challenge")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// SetAuthNtlm starts the handshake with a Negotiate message, or
+// finishes it with the Authenticate message once the challenge is in.
+func (p *Plugin) SetAuthNtlm() error {
+
+	if p.ntlmCredentials == nil {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetAuthNtlm http request is nil")
+	}
+
+	message := NtlmNegotiateMessage()
+	p.ntlmAuthenticateSent = false
+
+	if p.ntlmChallenge != nil {
+		clientChallenge := make([]byte, 8)
+		if _, err := rand.Read(clientChallenge); err != nil {
+			return err
+		}
+
+		var err error
+		message, err = NtlmAuthenticateMessage(p.ntlmChallenge, p.ntlmCredentials, clientChallenge, time.Now())
+		if err != nil {
+			return err
+		}
+
+		// a retry starts a new handshake on a new connection
+		p.ntlmChallenge = nil
+		p.ntlmAuthenticateSent = true
+	}
+
+	p.HttpReq.Header.Set(AuthorizationHeader, "NTLM "+base64.StdEncoding.EncodeToString(message))
+
+	return nil
+}
+
+func NtlmNegotiateMessage() []byte {
+
+	message := make([]byte, 32)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 1)
+	binary.LittleEndian.PutUint32(message[12:], ntlmNegotiateFlags)
+
+	return message
+}
+
+type NtlmChallengeMessage struct {
+	Flags           uint32
+	ServerChallenge []byte
+	TargetInfo      []byte
+}
+
+func ParseNtlmChallengeMessage(message []byte) (*NtlmChallengeMessage, error) {
+
+	if len(message) < 48 || string(message[:8]) != ntlmSignature || binary.LittleEndian.Uint32(message[8:]) != 2 {
+		return nil, errors.New("invalid ntlm challenge message")
+	}
+
+	challenge := &NtlmChallengeMessage{
+		Flags:           binary.LittleEndian.Uint32(message[20:]),
+		ServerChallenge: message[24:32],
+	}
+
+	length := int(binary.LittleEndian.Uint16(message[40:]))
+	offset := int(binary.LittleEndian.Uint32(message[44:]))
+	if offset > len(message) || length > len(message)-offset {
+		return nil, errors.New("invalid ntlm challenge message, target info out of bounds")
+	}
+	challenge.TargetInfo = message[offset : offset+length]
+
+	return challenge, nil
+}
+
+// NtlmAuthenticateMessage computes the NTLMv2 response to the challenge
+// message.
+func NtlmAuthenticateMessage(challengeMessage []byte, credentials *NtlmCredentials, clientChallenge []byte, now time.Time) ([]byte, error) {
+
+	challenge, err := ParseNtlmChallengeMessage(challengeMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	responseKey := NtlmV2Hash(credentials)
+
+	timestamp, hasTimestamp := ntlmTargetInfoTimestamp(challenge.TargetInfo)
+	if !hasTimestamp {
+		timestamp = make([]byte, 8)
+		// windows file time, 100ns intervals since 1601
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.Unix()*10000000+int64(now.Nanosecond()/100)+116444736000000000))
+	}
+
+	var temp bytes.Buffer
+	temp.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(challenge.TargetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	ntProofStr := hmacMd5(responseKey, challenge.ServerChallenge, temp.Bytes())
+	ntResponse := append(ntProofStr, temp.Bytes()...)
+
+	// the LMv2 response is zeroed when the server sends a timestamp
+	lmResponse := make([]byte, 24)
+	if !hasTimestamp {
+		lmResponse = append(hmacMd5(responseKey, challenge.ServerChallenge, clientChallenge), clientChallenge...)
+	}
+
+	flags := challenge.Flags & ntlmNegotiateFlags
+	encode := func(s string) []byte {
+		if flags&ntlmNegotiateUnicode != 0 {
+			return utf16le(s)
+		}
+		return []byte(s)
+	}
+
+	fields := [][]byte{
+		lmResponse,
+		ntResponse,
+		encode(credentials.Domain),
+		encode(credentials.User),
+		encode(""),
+		nil,
+	}
+
+	const headerLength = 64
+	message := make([]byte, headerLength)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 3)
+
+	offset := headerLength
+	for i, field := range fields {
+		position := 12 + i*8
+		binary.LittleEndian.PutUint16(message[position:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(message[position+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(message[position+4:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(message[60:], flags)
+
+	for _, field := range fields {
+		message = append(message, field...)
+	}
+
+	return message, nil
+}
+
+// NtlmV2Hash is NTOWFv2, the HMAC-MD5 of the upper cased user and the
+// domain keyed with the MD4 of the password.
+func NtlmV2Hash(credentials *NtlmCredentials) []byte {
+	ntHash := Md4(utf16le(credentials.Pass))
+	return hmacMd5(ntHash, utf16le(strings.ToUpper(credentials.User)+credentials.Domain))
+}
+
+func ntlmTargetInfoTimestamp(targetInfo []byte) ([]byte, bool) {
+
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if id == ntlmAvEol || length > len(targetInfo)-4 {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[4:12], true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+
+	return nil, false
+}
+
+func hmacMd5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(out[2*i:], r)
+	}
+	return out
+}
+
+// Md4 is the RFC 1320 message digest that NTLM hashes passwords with.
+func Md4(message []byte) []byte {
+	h := md4.New()
+	h.Write(message)
+	return h.Sum(nil)
+}
@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ntlmTestChallenge builds a Challenge message with the target info of
+// the MS-NLMP examples, plus a timestamp when one is given.
+func ntlmTestChallenge(serverChallenge []byte, timestamp []byte) []byte {
+
+	var targetInfo bytes.Buffer
+	avPair := func(id uint16, value []byte) {
+		binary.Write(&targetInfo, binary.LittleEndian, id)
+		binary.Write(&targetInfo, binary.LittleEndian, uint16(len(value)))
+		targetInfo.Write(value)
+	}
+	avPair(2, utf16le("Domain"))
+	avPair(1, utf16le("Server"))
+	if timestamp != nil {
+		avPair(ntlmAvTimestamp, timestamp)
+	}
+	avPair(ntlmAvEol, nil)
+
+	message := make([]byte, 48)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 2)
+	binary.LittleEndian.PutUint32(message[20:], ntlmNegotiateFlags)
+	copy(message[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(message[40:], uint16(targetInfo.Len()))
+	binary.LittleEndian.PutUint16(message[42:], uint16(targetInfo.Len()))
+	binary.LittleEndian.PutUint32(message[44:], 48)
+
+	return append(message, targetInfo.Bytes()...)
+}
+
+// ntlmTestField returns a security buffer of an Authenticate message.
+func ntlmTestField(message []byte, index int) []byte {
+	position := 12 + index*8
+	length := int(binary.LittleEndian.Uint16(message[position:]))
+	offset := int(binary.LittleEndian.Uint32(message[position+4:]))
+	return message[offset : offset+length]
+}
+
+func TestNtlmMessages(t *testing.T) {
+
+	_, found := enableTests["TestNtlmMessages"]
+	if !found {
+		t.Skip("Skipping TestNtlmMessages test")
+	}
+
+	// RFC 1320 test suite
+	for message, digest := range map[string]string{
+		"":               "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc":            "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest": "d9130a8164549fe818874806e1c7014b",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	} {
+		if got := hex.EncodeToString(Md4([]byte(message))); got != digest {
+			t.Errorf("Md4(%q) = %s, expected %s", message, got, digest)
+		}
+	}
+
+	// MS-NLMP 4.2.4 NTLMv2 authentication example
+	credentials := &NtlmCredentials{Domain: "Domain", User: "User", Pass: "Password"}
+
+	if got := hex.EncodeToString(NtlmV2Hash(credentials)); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("Unexpected NTOWFv2 %s", got)
+	}
+
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge, _ := hex.DecodeString("aaaaaaaaaaaaaaaa")
+	fileTimeZero := time.Unix(-11644473600, 0)
+
+	message, err := NtlmAuthenticateMessage(ntlmTestChallenge(serverChallenge, nil), credentials, clientChallenge, fileTimeZero)
+	if err != nil {
+		t.Fatalf("NtlmAuthenticateMessage() returned an error: %v", err)
+	}
+
+	if got := hex.EncodeToString(ntlmTestField(message, 1)[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("Unexpected NTProofStr %s", got)
+	}
+	if got := hex.EncodeToString(ntlmTestField(message, 0)); got != "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa" {
+		t.Errorf("Unexpected LMv2 response %s", got)
+	}
+	if !bytes.Equal(ntlmTestField(message, 3), utf16le("User")) || !bytes.Equal(ntlmTestField(message, 2), utf16le("Domain")) {
+		t.Errorf("Unexpected user or domain in the Authenticate message")
+	}
+
+	if _, err := ParseNtlmChallengeMessage([]byte("NTLMSSP\x00\x02\x00\x00\x00")); err == nil {
+		t.Errorf("Expected a truncated challenge message to be rejected")
+	}
+}
+
+func TestNtlmAuthWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestNtlmAuthWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestNtlmAuthWithLocalServer test")
+	}
+
+	var mu sync.Mutex
+	var handshakes []string
+	pending := map[string][]byte{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		unauthorized := func(token string) {
+			w.Header().Set("WWW-Authenticate", strings.TrimSpace("NTLM "+token))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "NTLM ") {
+			unauthorized("")
+			return
+		}
+		message, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+		if len(message) < 12 || string(message[:8]) != ntlmSignature {
+			unauthorized("")
+			return
+		}
+
+		switch binary.LittleEndian.Uint32(message[8:]) {
+		case 1:
+			serverChallenge := []byte(r.RemoteAddr + "........")[:8]
+			challenge := ntlmTestChallenge(serverChallenge, make([]byte, 8))
+			pending[r.RemoteAddr] = serverChallenge
+			handshakes = append(handshakes, "negotiate "+r.RemoteAddr)
+			unauthorized(base64.StdEncoding.EncodeToString(challenge))
+
+		case 3:
+			serverChallenge, ok := pending[r.RemoteAddr]
+			delete(pending, r.RemoteAddr)
+			handshakes = append(handshakes, "authenticate "+r.RemoteAddr)
+			if !ok {
+				unauthorized("")
+				return
+			}
+
+			credentials := &NtlmCredentials{
+				Domain: "CORP",
+				User:   "builder",
+				Pass:   "p@ss:w0rd",
+			}
+			ntResponse := ntlmTestField(message, 1)
+			expected := hmacMd5(NtlmV2Hash(credentials), serverChallenge, ntResponse[16:])
+			if !bytes.Equal(ntResponse[:16], expected) || !bytes.Equal(ntlmTestField(message, 0), make([]byte, 24)) {
+				unauthorized("")
+				return
+			}
+			w.Write([]byte("welcome"))
+		}
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:               ts.URL + "/sites/build/_api/web",
+			HttpMethod:        "POST",
+			RequestBody:       `{"title":"build 42"}`,
+			AuthNtlm:          `CORP\builder:p@ss:w0rd`,
+			ValidResponseBody: "welcome",
+			Quiet:             true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	if len(handshakes) != 2 || strings.Fields(handshakes[0])[1] != strings.Fields(handshakes[1])[1] {
+		t.Errorf("Expected the handshake on one connection, got %v", handshakes)
+	}
+
+	args.AuthNtlm = `CORP\builder:wrong`
+	if err := Exec(context.Background(), args); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected a wrong password to fail with 401, got %v", err)
+	}
+}
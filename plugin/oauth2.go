@@ -0,0 +1,140 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	OAuth2AuthStyleHeader = "header"
+	OAuth2AuthStyleBody   = "body"
+)
+
+type OAuth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (p *Plugin) IsOAuth2() bool {
+	return p.OAuth2TokenUrl != ""
+}
+
+// ValidateOAuth2 checks the client credentials settings. The token
+// replaces any other way of setting the Authorization header.
+func (p *Plugin) ValidateOAuth2() error {
+
+	if !p.IsOAuth2() {
+		if p.OAuth2ClientId != "" || p.OAuth2ClientSecret != "" {
+			return errors.New("oauth2_token_url is required with oauth2_client_id and oauth2_client_secret")
+		}
+		return nil
+	}
+
+	tokenUrl, err := url.Parse(p.OAuth2TokenUrl)
+	if err != nil || tokenUrl.Host == "" {
+		return errors.New("invalid oauth2_token_url " + p.OAuth2TokenUrl)
+	}
+
+	if p.OAuth2ClientId == "" || p.OAuth2ClientSecret == "" {
+		return errors.New("oauth2_client_id and oauth2_client_secret are required with oauth2_token_url")
+	}
+
+	switch strings.ToLower(p.OAuth2AuthStyle) {
+	case "", OAuth2AuthStyleHeader, OAuth2AuthStyleBody:
+	default:
+		return errors.New("invalid oauth2_auth_style " + p.OAuth2AuthStyle + ", expected header or body")
+	}
+
+	if p.IsAuthBasic() || p.AuthBearer != "" || p.AuthBearerFile != "" {
+		return errors.New("oauth2_token_url cannot be combined with auth_basic or auth_bearer")
+	}
+
+	return nil
+}
+
+// FetchOAuth2Token requests an access token with the client credentials
+// grant. It goes through the client of the main request so the same
+// proxy and certificates apply to the token endpoint.
+func (p *Plugin) FetchOAuth2Token() error {
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	if scopes := SplitSettingList(p.OAuth2Scopes); len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	if p.OAuth2Audience != "" {
+		form.Set("audience", p.OAuth2Audience)
+	}
+
+	isBodyAuth := strings.ToLower(p.OAuth2AuthStyle) == OAuth2AuthStyleBody
+	if isBodyAuth {
+		form.Set("client_id", p.OAuth2ClientId)
+		form.Set("client_secret", p.OAuth2ClientSecret)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.TimeOutDuration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.OAuth2TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", ApplicationJson)
+
+	if !isBodyAuth {
+		req.SetBasicAuth(url.QueryEscape(p.OAuth2ClientId), url.QueryEscape(p.OAuth2ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return errors.New("oauth2 token request failed: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.New("oauth2 token request failed: " + err.Error())
+	}
+
+	var token OAuth2TokenResponse
+	jsonErr := json.Unmarshal(body, &token)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if jsonErr == nil && token.Error != "" {
+			return fmt.Errorf("oauth2 token request failed with status %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+		}
+		return fmt.Errorf("oauth2 token request failed with status %d", resp.StatusCode)
+	}
+
+	if jsonErr != nil {
+		return errors.New("oauth2 token response is not valid json")
+	}
+	if token.AccessToken == "" {
+		return errors.New("oauth2 token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return errors.New("unsupported oauth2 token_type " + token.TokenType)
+	}
+
+	p.oauth2Token = token.AccessToken
+	p.bearerToken = token.AccessToken
+
+	LogPrintf(p, "fetched oauth2 access token, expires in %ds\n", token.ExpiresIn)
+
+	return nil
+}
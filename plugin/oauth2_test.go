@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type oauth2TestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	issued   int
+	forms    []string
+	bodies   []string
+	basicIds []string
+}
+
+func newOAuth2TestServer() *oauth2TestServer {
+
+	s := &oauth2TestServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/token":
+			r.ParseForm()
+			id, secret, ok := r.BasicAuth()
+			if ok {
+				s.basicIds = append(s.basicIds, id)
+			} else {
+				id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+			}
+			if id != "drone" || secret != "c1i3nt-s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+				return
+			}
+			s.issued++
+			s.forms = append(s.forms, r.PostForm.Get("scope")+"|"+r.PostForm.Get("audience"))
+			fmt.Fprintf(w, `{"access_token":"t0k3n-%d","token_type":"Bearer","expires_in":60}`, s.issued)
+
+		case "/api":
+			body, _ := io.ReadAll(r.Body)
+			s.bodies = append(s.bodies, r.Header.Get("Authorization")+" "+string(body))
+			// the first token is treated as expired
+			if r.Header.Get("Authorization") != "Bearer t0k3n-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	return s
+}
+
+func TestOAuth2WithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestOAuth2WithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestOAuth2WithLocalServer test")
+	}
+
+	ts := newOAuth2TestServer()
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:                ts.URL + "/api",
+			HttpMethod:         "POST",
+			RequestBody:        "payload",
+			OAuth2TokenUrl:     ts.URL + "/token",
+			OAuth2ClientId:     "drone",
+			OAuth2ClientSecret: "c1i3nt-s3cr3t",
+			OAuth2Scopes:       "read,write",
+			OAuth2Audience:     "https://api.example.com",
+			Quiet:              true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	if ts.issued != 2 {
+		t.Errorf("Expected the token to be refreshed once, %d tokens issued", ts.issued)
+	}
+	if len(ts.basicIds) != 2 {
+		t.Errorf("Expected the client credentials in the Authorization header, got %v", ts.basicIds)
+	}
+	if ts.forms[0] != "read write|https://api.example.com" {
+		t.Errorf("Expected scopes and audience in the token request, got %q", ts.forms[0])
+	}
+	expected := []string{"Bearer t0k3n-1 payload", "Bearer t0k3n-2 payload"}
+	if strings.Join(ts.bodies, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the request to be sent again with the new token, got %q", ts.bodies)
+	}
+
+	args.OAuth2AuthStyle = "body"
+	ts.issued, ts.basicIds = 1, nil
+
+	err = Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() with body auth style returned an error: %v", err)
+	}
+	if len(ts.basicIds) != 0 || ts.issued != 2 {
+		t.Errorf("Expected the client credentials in the body, got %v", ts.basicIds)
+	}
+
+	// a token rejected after the refresh fails the request
+	ts.issued = 5
+	if err := Exec(context.Background(), args); err == nil {
+		t.Errorf("Expected a second 401 to fail the request")
+	}
+}
+
+func TestOAuth2TokenErrors(t *testing.T) {
+
+	_, found := enableTests["TestOAuth2TokenErrors"]
+	if !found {
+		t.Skip("Skipping TestOAuth2TokenErrors test")
+	}
+
+	ts := newOAuth2TestServer()
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:                ts.URL + "/api",
+			HttpMethod:         "GET",
+			OAuth2TokenUrl:     ts.URL + "/token",
+			OAuth2ClientId:     "drone",
+			OAuth2ClientSecret: "wr0ng-s3cr3t",
+			Quiet:              true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err == nil || !strings.Contains(err.Error(), "invalid_client bad credentials") {
+		t.Errorf("Expected the token endpoint error, got: %v", err)
+	}
+
+	invalid := []PluginInputParams{
+		{OAuth2ClientId: "drone", OAuth2ClientSecret: "secret"},
+		{OAuth2TokenUrl: ts.URL + "/token", OAuth2ClientId: "drone"},
+		{OAuth2TokenUrl: ts.URL + "/token", OAuth2ClientId: "drone", OAuth2ClientSecret: "secret", OAuth2AuthStyle: "jwt"},
+		{OAuth2TokenUrl: ts.URL + "/token", OAuth2ClientId: "drone", OAuth2ClientSecret: "secret", AuthBearer: "token"},
+	}
+
+	for _, params := range invalid {
+		params.Url = ts.URL + "/api"
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		if err := Exec(context.Background(), Args{PluginInputParams: params}); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
@@ -8,15 +8,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -32,26 +35,98 @@ type PluginConfigParams struct {
 }
 
 type PluginInputParams struct {
-	Url                string `envconfig:"PLUGIN_URL"`
-	HttpMethod         string `envconfig:"PLUGIN_HTTP_METHOD"`
-	Headers            string `envconfig:"PLUGIN_HEADERS"`
-	ContentType        string `envconfig:"PLUGIN_CONTENT_TYPE"`
-	RequestBody        string `envconfig:"PLUGIN_REQUEST_BODY"`
-	AuthBasic          string `envconfig:"PLUGIN_AUTH_BASIC"`
-	AuthCert           string `envconfig:"PLUGIN_AUTH_CERT"`
-	ValidResponseCodes string `envconfig:"PLUGIN_VALID_RESPONSE_CODES"`
-	ValidResponseBody  string `envconfig:"PLUGIN_VALID_RESPONSE_BODY"`
-	Timeout            int    `envconfig:"PLUGIN_TIMEOUT"`
-	IgnoreSsl          bool   `envconfig:"PLUGIN_IGNORE_SSL"`
-	Proxy              string `envconfig:"PLUGIN_PROXY"`
-	OutputFile         string `envconfig:"PLUGIN_OUTPUT_FILE"`
-	AcceptType         string `envconfig:"PLUGIN_ACCEPT_TYPE"`
-	LogResponse        bool   `envconfig:"PLUGIN_LOG_RESPONSE"`
-	Quiet              bool   `envconfig:"PLUGIN_QUIET"`
-	UploadFile         string `envconfig:"PLUGIN_UPLOAD_FILE"`
-	MultiPartName      string `envconfig:"PLUGIN_MULTIPART_NAME"`
-	WrapAsMultipart    bool   `envconfig:"PLUGIN_WRAP_AS_MULTIPART"`
-	SslCertPath        string `envconfig:"PLUGIN_SSL_CERT_PATH"`
+	Url                 string          `envconfig:"PLUGIN_URL"`
+	HttpMethod          string          `envconfig:"PLUGIN_HTTP_METHOD"`
+	Headers             string          `envconfig:"PLUGIN_HEADERS"`
+	ContentType         string          `envconfig:"PLUGIN_CONTENT_TYPE"`
+	RequestBody         string          `envconfig:"PLUGIN_REQUEST_BODY"`
+	AuthBasic           string          `envconfig:"PLUGIN_AUTH_BASIC" secret:"true"`
+	AuthCert            string          `envconfig:"PLUGIN_AUTH_CERT"` // deprecated, alias of SslCertPath
+	ValidResponseCodes  string          `envconfig:"PLUGIN_VALID_RESPONSE_CODES"`
+	ValidResponseBody   string          `envconfig:"PLUGIN_VALID_RESPONSE_BODY"`
+	Timeout             DurationSeconds `envconfig:"PLUGIN_TIMEOUT"`
+	IgnoreSsl           bool            `envconfig:"PLUGIN_IGNORE_SSL"`
+	Proxy               string          `envconfig:"PLUGIN_PROXY"`
+	OutputFile          string          `envconfig:"PLUGIN_OUTPUT_FILE"`
+	AcceptType          string          `envconfig:"PLUGIN_ACCEPT_TYPE"`
+	LogResponse         bool            `envconfig:"PLUGIN_LOG_RESPONSE"`
+	Quiet               bool            `envconfig:"PLUGIN_QUIET"`
+	UploadFile          string          `envconfig:"PLUGIN_UPLOAD_FILE"`
+	MultiPartName       string          `envconfig:"PLUGIN_MULTIPART_NAME"`
+	WrapAsMultipart     bool            `envconfig:"PLUGIN_WRAP_AS_MULTIPART"`
+	SslCertPath         string          `envconfig:"PLUGIN_SSL_CERT_PATH"`
+	AssertJson          string          `envconfig:"PLUGIN_ASSERT_JSON"`
+	ValidResponseRegex  string          `envconfig:"PLUGIN_VALID_RESPONSE_REGEX"`
+	InvalidResponseBody string          `envconfig:"PLUGIN_INVALID_RESPONSE_BODY"`
+	AssertHeaders       string          `envconfig:"PLUGIN_ASSERT_HEADERS"`
+	ResponseSchema      string          `envconfig:"PLUGIN_RESPONSE_SCHEMA"`
+	Retries             int             `envconfig:"PLUGIN_RETRIES"`
+	RetryBackoff        string          `envconfig:"PLUGIN_RETRY_BACKOFF"`
+	RetryOn             string          `envconfig:"PLUGIN_RETRY_ON"`
+	PollInterval        string          `envconfig:"PLUGIN_POLL_INTERVAL"`
+	PollTimeout         string          `envconfig:"PLUGIN_POLL_TIMEOUT"`
+	Requests            string          `envconfig:"PLUGIN_REQUESTS"`
+	Urls                string          `envconfig:"PLUGIN_URLS"`
+	Batch               bool            `envconfig:"PLUGIN_BATCH"`
+	Concurrency         int             `envconfig:"PLUGIN_CONCURRENCY"`
+	MaxFailures         int             `envconfig:"PLUGIN_MAX_FAILURES"`
+	Template            bool            `envconfig:"PLUGIN_TEMPLATE"`
+	TemplateUpload      bool            `envconfig:"PLUGIN_TEMPLATE_UPLOAD"`
+	AuthBearer          string          `envconfig:"PLUGIN_AUTH_BEARER" secret:"true"`
+	AuthBearerFile      string          `envconfig:"PLUGIN_AUTH_BEARER_FILE"`
+	ApiKey              string          `envconfig:"PLUGIN_API_KEY" secret:"true"`
+	ApiKeyIn            string          `envconfig:"PLUGIN_API_KEY_IN"`
+	ApiKeyName          string          `envconfig:"PLUGIN_API_KEY_NAME"`
+	OAuth2TokenUrl      string          `envconfig:"PLUGIN_OAUTH2_TOKEN_URL"`
+	OAuth2ClientId      string          `envconfig:"PLUGIN_OAUTH2_CLIENT_ID"`
+	OAuth2ClientSecret  string          `envconfig:"PLUGIN_OAUTH2_CLIENT_SECRET" secret:"true"`
+	OAuth2Scopes        string          `envconfig:"PLUGIN_OAUTH2_SCOPES"`
+	OAuth2Audience      string          `envconfig:"PLUGIN_OAUTH2_AUDIENCE"`
+	OAuth2AuthStyle     string          `envconfig:"PLUGIN_OAUTH2_AUTH_STYLE"`
+	AuthAwsSigv4        bool            `envconfig:"PLUGIN_AUTH_AWS_SIGV4"`
+	AwsRegion           string          `envconfig:"PLUGIN_AWS_REGION"`
+	AwsService          string          `envconfig:"PLUGIN_AWS_SERVICE"`
+	HmacSecret          string          `envconfig:"PLUGIN_HMAC_SECRET" secret:"true"`
+	HmacAlgorithm       string          `envconfig:"PLUGIN_HMAC_ALGORITHM"`
+	HmacHeader          string          `envconfig:"PLUGIN_HMAC_HEADER"`
+	HmacSigningString   string          `envconfig:"PLUGIN_HMAC_SIGNING_STRING"`
+	HmacTimestampHeader string          `envconfig:"PLUGIN_HMAC_TIMESTAMP_HEADER"`
+	HmacPreset          string          `envconfig:"PLUGIN_HMAC_PRESET"`
+	AuthDigest          string          `envconfig:"PLUGIN_AUTH_DIGEST" secret:"true"`
+	AuthNtlm            string          `envconfig:"PLUGIN_AUTH_NTLM" secret:"true"`
+
+	AuthBasicUsername           string `envconfig:"PLUGIN_AUTH_BASIC_USERNAME"`
+	AuthBasicPassword           string `envconfig:"PLUGIN_AUTH_BASIC_PASSWORD" secret:"true"`
+	AuthBasicPasswordFile       string `envconfig:"PLUGIN_AUTH_BASIC_PASSWORD_FILE"`
+	AuthBasicAllowEmptyPassword bool   `envconfig:"PLUGIN_AUTH_BASIC_ALLOW_EMPTY_PASSWORD"`
+	JwtPrivateKey               string `envconfig:"PLUGIN_JWT_PRIVATE_KEY"`
+	JwtAlgorithm                string `envconfig:"PLUGIN_JWT_ALGORITHM"`
+	JwtIssuer                   string `envconfig:"PLUGIN_JWT_ISSUER"`
+	JwtAudience                 string `envconfig:"PLUGIN_JWT_AUDIENCE"`
+	JwtSubject                  string `envconfig:"PLUGIN_JWT_SUBJECT"`
+	JwtTtl                      string `envconfig:"PLUGIN_JWT_TTL"`
+	JwtClaims                   string `envconfig:"PLUGIN_JWT_CLAIMS"`
+	ClientCert                  string `envconfig:"PLUGIN_CLIENT_CERT"`
+	ClientKey                   string `envconfig:"PLUGIN_CLIENT_KEY" secret:"true"`
+	ClientKeyPassword           string `envconfig:"PLUGIN_CLIENT_KEY_PASSWORD" secret:"true"`
+	CaCert                      string `envconfig:"PLUGIN_CA_CERT"`
+	ClientPkcs12                string `envconfig:"PLUGIN_CLIENT_PKCS12"`
+	ClientPkcs12Password        string `envconfig:"PLUGIN_CLIENT_PKCS12_PASSWORD" secret:"true"`
+	Http2                       bool   `envconfig:"PLUGIN_HTTP2"`
+	DisableKeepAlive            bool   `envconfig:"PLUGIN_DISABLE_KEEP_ALIVE"`
+	ConnectTimeout              string `envconfig:"PLUGIN_CONNECT_TIMEOUT"`
+	TlsHandshakeTimeout         string `envconfig:"PLUGIN_TLS_HANDSHAKE_TIMEOUT"`
+	ResponseHeaderTimeout       string `envconfig:"PLUGIN_RESPONSE_HEADER_TIMEOUT"`
+	ReadIdleTimeout             string `envconfig:"PLUGIN_READ_IDLE_TIMEOUT"`
+	TlsMinVersion               string `envconfig:"PLUGIN_TLS_MIN_VERSION"`
+	TlsMaxVersion               string `envconfig:"PLUGIN_TLS_MAX_VERSION"`
+	TlsCiphers                  string `envconfig:"PLUGIN_TLS_CIPHERS"`
+	TlsServerName               string `envconfig:"PLUGIN_TLS_SERVER_NAME"`
+	TlsPinSha256                string `envconfig:"PLUGIN_TLS_PIN_SHA256"`
+	NoProxy                     string `envconfig:"PLUGIN_NO_PROXY"`
+	ProxyUser                   string `envconfig:"PLUGIN_PROXY_USER"`
+	ProxyPassword               string `envconfig:"PLUGIN_PROXY_PASSWORD" secret:"true"`
+	ProxyFromEnv                bool   `envconfig:"PLUGIN_PROXY_FROM_ENV"`
 }
 
 type PluginProcessingInfo struct {
@@ -68,6 +143,38 @@ type PluginProcessingInfo struct {
 	proxyUrl                 *url.URL
 	uploadFileAbsolutePath   string
 	IsSuppressLogs           bool
+	responseCodePolicy       *ResponseCodePolicy
+	jsonAssertions           []*JsonAssertion
+	validResponseRegex       *regexp.Regexp
+	invalidResponseRegex     *regexp.Regexp
+	headerAssertions         []*HeaderAssertion
+	responseSchema           *JsonSchema
+	retryPolicy              *RetryPolicy
+	pollInterval             time.Duration
+	pollTimeout              time.Duration
+	pollDeadline             time.Time
+	templateData             map[string]interface{}
+	skipOutputEnv            bool
+	bearerToken              string
+	oauth2Token              string
+	oauth2Refreshed          bool
+	awsCredentials           *AwsCredentials
+	hmacSigner               *HmacSigner
+	digestCredentials        *DigestCredentials
+	digestChallenge          *DigestChallenge
+	ntlmCredentials          *NtlmCredentials
+	ntlmChallenge            []byte
+	ntlmAuthenticateSent     bool
+	jwtSigner                *JwtSigner
+	jwtToken                 string
+	clientCertificate        *tls.Certificate
+	caCertPool               *x509.CertPool
+	connectTimeout           time.Duration
+	tlsHandshakeTimeout      time.Duration
+	responseHeaderTimeout    time.Duration
+	readIdleTimeout          time.Duration
+	tlsPolicy                *TlsPolicy
+	proxyFunc                func(*url.URL) (*url.URL, error)
 }
 
 type PluginExecResultsCard struct {
@@ -85,6 +192,13 @@ type Plugin struct {
 
 func Exec(ctx context.Context, args Args) error {
 
+	switch {
+	case args.Urls != "" || (args.Batch && args.Requests != ""):
+		return ExecBatch(ctx, args)
+	case args.Requests != "":
+		return ExecSequence(ctx, args)
+	}
+
 	plugin := GetNewPlugin(args)
 
 	_ = plugin.Init()
@@ -138,7 +252,13 @@ func (p *Plugin) DeInit() error {
 
 func (p *Plugin) Run() error {
 
-	err := p.ValidateArgs()
+	err := p.RenderTemplates()
+	if err != nil {
+		log.Println("RenderTemplates failed err == ", err.Error())
+		return err
+	}
+
+	err = p.ValidateArgs()
 	if err != nil {
 		log.Println("ValidateArgs failed err == ", err.Error())
 		return err
@@ -146,14 +266,11 @@ func (p *Plugin) Run() error {
 
 	err = p.DoRequest()
 	if err != nil {
+		err = p.RedactError(err)
 		log.Println("DoRequest failed err == ", err.Error())
 		return err
 	}
 
-	if p.httpResponse.StatusCode == http.StatusUnsupportedMediaType {
-		return errors.New(fmt.Sprintf("http.StatusUnsupportedMediaType == %d", http.StatusUnsupportedMediaType))
-	}
-
 	err = p.StoreHttpResponseResults()
 	if err != nil {
 		return err
@@ -166,13 +283,38 @@ func (p *Plugin) CreateNewHttpRequest() error {
 	p.SetTimeout()
 	var ctx context.Context
 
-	ctx, p.HttpRequestCancelContext = context.WithTimeout(context.Background(), p.TimeOutDuration)
+	if p.HttpRequestCancelContext != nil {
+		p.HttpRequestCancelContext()
+	}
+
+	timeout := p.TimeOutDuration
+	if !p.pollDeadline.IsZero() {
+		if remaining := time.Until(p.pollDeadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	ctx, p.HttpRequestCancelContext = context.WithTimeout(context.Background(), timeout)
 
 	var err error
 
-	p.HttpReq, err = http.NewRequestWithContext(ctx, p.HttpMethod, p.Url, p.BodyIoReader)
-	if err != nil {
-		return err
+	if file, ok := p.BodyIoReader.(*os.File); ok {
+		// the transport closes the request body once it is sent, the
+		// file stays open so that it can be rewound for a retry
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		p.HttpReq, err = http.NewRequestWithContext(ctx, p.HttpMethod, p.Url, ioutil.NopCloser(file))
+		if err != nil {
+			return err
+		}
+		p.HttpReq.ContentLength = info.Size()
+	} else {
+		p.HttpReq, err = http.NewRequestWithContext(ctx, p.HttpMethod, p.Url, p.BodyIoReader)
+		if err != nil {
+			return err
+		}
 	}
 
 	p.HttpReq.Header.Set(ContentType, ApplicationJson)
@@ -187,7 +329,7 @@ func (p *Plugin) CreateNewHttpRequest() error {
 	return nil
 }
 
-func (p *Plugin) DoRequest() error {
+func (p *Plugin) PrepareHttpRequest() error {
 
 	err := p.CreateNewHttpRequest()
 	if err != nil {
@@ -204,23 +346,84 @@ func (p *Plugin) DoRequest() error {
 		return err
 	}
 
-	p.GetNewHttpClient()
+	err = p.SetAuthTokens()
+	if err != nil {
+		return err
+	}
 
-	err = p.SetHttpConnectionParameters()
+	err = p.SetAuthJwt()
 	if err != nil {
 		return err
 	}
 
-	p.httpResponse, err = p.httpClient.Do(p.HttpReq)
+	err = p.SetAuthDigest()
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			LogPrintln(p, "request timed out")
+		return err
+	}
+
+	err = p.SetAuthNtlm()
+	if err != nil {
+		return err
+	}
+
+	err = p.SetHmacSignature()
+	if err != nil {
+		return err
+	}
+
+	err = p.SetAwsSigv4()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Plugin) DoRequest() error {
+
+	p.SetTimeout()
+	p.GetNewHttpClient()
+
+	err := p.SetHttpConnectionParameters()
+	if err != nil {
+		return err
+	}
+
+	if p.IsOAuth2() {
+		err = p.FetchOAuth2Token()
+		if err != nil {
+			return err
 		}
+	}
+
+	p.pollDeadline = time.Time{}
+	if p.IsPollMode() {
+		p.pollDeadline = time.Now().Add(p.pollTimeout)
+	}
+
+	err = p.PrepareHttpRequest()
+	if err != nil {
+		return err
+	}
+
+	if p.IsPollMode() {
+		return p.PollUntilValidResponse()
+	}
+
+	err = p.SendHttpRequest()
+	if err != nil {
 		return err
 	}
 	p.isConnectionOpen = true
 
-	err = p.IsResponseStatusOk()
+	return p.ValidateHttpResponse()
+}
+
+// ValidateHttpResponse reads the response and runs every configured
+// check against it, it is also the success condition in poll mode.
+func (p *Plugin) ValidateHttpResponse() error {
+
+	err := p.IsResponseStatusOk()
 	if err != nil {
 		return err
 	}
@@ -235,25 +438,170 @@ func (p *Plugin) DoRequest() error {
 		return err
 	}
 
+	err = p.CheckResponseHeaders()
+	if err != nil {
+		return err
+	}
+
+	err = p.CheckResponseSchema()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// SendHttpRequest sends the prepared request, retrying it as configured
+// by retries, retry_backoff and retry_on. Every retry rewinds the body
+// and prepares a fresh request.
+func (p *Plugin) SendHttpRequest() error {
+
+	for attempt := 1; ; attempt++ {
+
+		if attempt > 1 {
+			err := p.RewindRequestBody()
+			if err != nil {
+				return err
+			}
+			err = p.PrepareHttpRequest()
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		p.httpResponse, err = p.DoHttpRequest()
+		if err != nil && errors.Is(err, context.DeadlineExceeded) {
+			LogPrintln(p, "request timed out")
+		}
+
+		reason := p.retryReason(p.httpResponse, err)
+		if reason == "" || attempt > p.Retries {
+			return err
+		}
+
+		delay, ok := p.retryDelay(attempt, p.httpResponse)
+		if !ok {
+			LogPrintf(p, "attempt %d failed (%s), Retry-After %s exceeds the retry_backoff max delay, not retrying\n", attempt, reason, delay)
+			return err
+		}
+
+		// in poll mode the retries of an attempt share the poll deadline,
+		// there is no retry when the backoff would run past it
+		if !p.pollDeadline.IsZero() && delay >= time.Until(p.pollDeadline) {
+			return err
+		}
+
+		LogPrintf(p, "attempt %d of %d failed (%s), retrying in %s\n", attempt, p.Retries+1, reason, delay)
+
+		p.discardHttpResponse()
+		time.Sleep(delay)
+	}
+}
+
+// DoHttpRequest sends the prepared request once. A 401 that carries an
+// auth challenge the plugin can answer, an expired oauth2 token or a
+// digest or ntlm challenge, is answered by sending the request again.
+func (p *Plugin) DoHttpRequest() (*http.Response, error) {
+
+	for {
+		resp, err := p.httpClient.Do(p.HttpReq)
+		if err == nil {
+			p.SetReadIdleTimeout(resp)
+		}
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		answered, err := p.AnswerAuthChallenge(resp)
+		if !answered && err == nil {
+			return resp, nil
+		}
+
+		p.httpResponse = resp
+		p.discardHttpResponse()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.RewindRequestBody()
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.PrepareHttpRequest()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
 func (p *Plugin) CheckForValidResponseBody() error {
 
-	if len(p.ValidResponseBody) < 1 {
-		return nil
+	if len(p.ValidResponseBody) > 0 && !strings.Contains(p.ResponseContent, p.ValidResponseBody) {
+		return errors.New("response body does not contain the expected string")
 	}
 
-	if strings.Contains(p.ResponseContent, p.ValidResponseBody) {
-		return nil
+	if p.validResponseRegex != nil && !p.validResponseRegex.MatchString(p.ResponseContent) {
+		return errors.New("response body does not match valid_response_regex " + p.ValidResponseRegex)
+	}
+
+	if p.invalidResponseRegex != nil {
+		if match := p.invalidResponseRegex.FindString(p.ResponseContent); match != "" {
+			return errors.New("response body contains invalid content " + match)
+		}
+	} else if len(p.InvalidResponseBody) > 0 && strings.Contains(p.ResponseContent, p.InvalidResponseBody) {
+		return errors.New("response body contains invalid content " + p.InvalidResponseBody)
 	}
 
-	return errors.New("response body does not contain the expected string")
+	return p.CheckJsonAssertions()
+}
+
+// ValidateResponseBodyMatchers compiles valid_response_regex as a
+// multiline RE2 expression. invalid_response_body is a plain string
+// unless it is written as /regex/.
+func (p *Plugin) ValidateResponseBodyMatchers() error {
+
+	var err error
+
+	p.validResponseRegex = nil
+	if p.ValidResponseRegex != "" {
+		p.validResponseRegex, err = regexp.Compile("(?m)" + p.ValidResponseRegex)
+		if err != nil {
+			return errors.New("invalid valid_response_regex: " + err.Error())
+		}
+	}
+
+	p.invalidResponseRegex = nil
+	invalidBody := p.InvalidResponseBody
+	if len(invalidBody) > 2 && strings.HasPrefix(invalidBody, "/") && strings.HasSuffix(invalidBody, "/") {
+		p.invalidResponseRegex, err = regexp.Compile("(?m)" + invalidBody[1:len(invalidBody)-1])
+		if err != nil {
+			return errors.New("invalid invalid_response_body: " + err.Error())
+		}
+	}
+
+	return nil
 }
 
 func (p *Plugin) IsResponseStatusOk() error {
-	if p.ResponseStatus < 200 && p.ResponseStatus > 299 {
-		return errors.New("bad response status")
+
+	if p.httpResponse == nil {
+		return errors.New("IsResponseStatusOk http response is nil")
+	}
+
+	if p.responseCodePolicy == nil {
+		err := p.ValidateResponseCodes()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := p.responseCodePolicy.Check(p.httpResponse.StatusCode)
+	if err != nil {
+		LogPrintln(p, err.Error())
+		return err
 	}
 	return nil
 }
@@ -279,6 +627,10 @@ func (p *Plugin) StoreHttpResponseResults() error {
 		}
 	}
 
+	if p.skipOutputEnv {
+		return nil
+	}
+
 	type EnvKvPair struct {
 		Key   string
 		Value interface{}
@@ -337,15 +689,9 @@ func (p *Plugin) GetNewHttpClient() {
 	}
 }
 
-func (p *Plugin) SetSslCert() {
-	if p.AuthCert == "" || p.IgnoreSsl {
-		return
-	}
-}
-
 func (p *Plugin) SetAuthBasic() error {
 
-	if p.AuthBasic == "" {
+	if !p.IsAuthBasic() {
 		return nil
 	}
 
@@ -353,9 +699,7 @@ func (p *Plugin) SetAuthBasic() error {
 		return errors.New("SetAuthBasic http request is nil")
 	}
 
-	if p.AuthUser != "" && p.AuthPass != "" {
-		p.HttpReq.SetBasicAuth(p.AuthUser, p.AuthPass)
-	}
+	p.HttpReq.SetBasicAuth(p.AuthUser, p.AuthPass)
 	return nil
 }
 
@@ -364,7 +708,7 @@ func (p *Plugin) SetTimeout() {
 		p.TimeOutDuration = 60 * time.Second
 		return
 	}
-	p.TimeOutDuration = time.Duration(p.Timeout) * time.Second
+	p.TimeOutDuration = p.Timeout.Duration()
 }
 
 func (p *Plugin) SetHeaders() error {
@@ -412,29 +756,126 @@ func (p *Plugin) ValidateArgs() error {
 		return errors.New("request_body is required")
 	}
 
-	if p.ValidateAuthBasic() != nil {
-		LogPrintln(p, "auth_basic info not good")
-		return errors.New("auth_basic info not good")
+	if err := p.ValidateAuthBasic(); err != nil {
+		LogPrintln(p, "auth_basic info not good ", err.Error())
+		return errors.New("auth_basic info not good: " + err.Error())
+	}
+
+	if err := p.ValidateAuthTokens(); err != nil {
+		LogPrintln(p, "invalid auth settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateOAuth2(); err != nil {
+		LogPrintln(p, "invalid oauth2 settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateAwsSigv4(); err != nil {
+		LogPrintln(p, "invalid aws sigv4 settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateHmac(); err != nil {
+		LogPrintln(p, "invalid hmac settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateAuthDigest(); err != nil {
+		LogPrintln(p, "invalid auth_digest ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateAuthNtlm(); err != nil {
+		LogPrintln(p, "invalid auth_ntlm ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateJwt(); err != nil {
+		LogPrintln(p, "invalid jwt settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateAuthCert(); err != nil {
+		LogPrintln(p, "invalid ssl_cert_path ", err.Error())
+		return errors.New("invalid ssl_cert_path: " + err.Error())
+	}
+
+	if err := p.ValidateClientTls(); err != nil {
+		LogPrintln(p, "invalid client tls settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateResponseCodes(); err != nil {
+		LogPrintln(p, "invalid valid_response_codes ", err.Error())
+		return errors.New("invalid valid_response_codes: " + err.Error())
+	}
+
+	if err := p.ValidateResponseBodyMatchers(); err != nil {
+		LogPrintln(p, err.Error())
+		return err
+	}
+
+	if err := p.ValidateJsonAssertions(); err != nil {
+		LogPrintln(p, "invalid assert_json ", err.Error())
+		return errors.New("invalid assert_json: " + err.Error())
+	}
+
+	if err := p.ValidateHeaderAssertions(); err != nil {
+		LogPrintln(p, "invalid assert_headers ", err.Error())
+		return errors.New("invalid assert_headers: " + err.Error())
+	}
+
+	if err := p.ValidateResponseSchema(); err != nil {
+		LogPrintln(p, "invalid response_schema ", err.Error())
+		return errors.New("invalid response_schema: " + err.Error())
 	}
 
-	if p.ValidateAuthCert() != nil {
-		LogPrintln(p, "certificate file not found")
-		return errors.New("certificate file not found")
+	if err := p.ValidateTlsPolicy(); err != nil {
+		LogPrintln(p, "invalid tls settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateProxy(); err != nil {
+		LogPrintln(p, "invalid proxy settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateTimeouts(); err != nil {
+		LogPrintln(p, "invalid timeout settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidateRetry(); err != nil {
+		LogPrintln(p, "invalid retry settings ", err.Error())
+		return err
+	}
+
+	if err := p.ValidatePoll(); err != nil {
+		LogPrintln(p, "invalid poll settings ", err.Error())
+		return err
 	}
 
 	return nil
 }
 
+// ValidateAuthCert checks the combined certificate and key PEM of
+// ssl_cert_path. auth_cert is the older name of the same setting.
 func (p *Plugin) ValidateAuthCert() error {
-	if p.AuthCert == "" {
-		return nil
+
+	if p.AuthCert != "" {
+		if p.SslCertPath != "" && p.SslCertPath != p.AuthCert {
+			return errors.New("auth_cert and ssl_cert_path are the same setting, set only ssl_cert_path")
+		}
+		LogPrintln(p, "auth_cert is deprecated, use ssl_cert_path")
+		p.SslCertPath = p.AuthCert
 	}
 
-	if _, err := os.Stat(p.AuthCert); os.IsNotExist(err) {
-		return err
+	if p.SslCertPath == "" {
+		return nil
 	}
 
-	cert, err := os.ReadFile(p.AuthCert)
+	cert, err := os.ReadFile(p.SslCertPath)
 	if err != nil {
 		return err
 	}
@@ -447,21 +888,60 @@ func (p *Plugin) ValidateAuthCert() error {
 	return nil
 }
 
+func (p *Plugin) IsAuthBasic() bool {
+	return p.AuthBasic != "" || p.AuthBasicUsername != ""
+}
+
+// ValidateAuthBasic reads the credentials from auth_basic, written as
+// user:pass where only the first colon separates the two, or from
+// auth_basic_username with auth_basic_password or
+// auth_basic_password_file. An empty password is only sent when
+// auth_basic_allow_empty_password is set.
 func (p *Plugin) ValidateAuthBasic() error {
 
-	if p.AuthBasic == "" {
+	if !p.IsAuthBasic() {
+		if p.AuthBasicPassword != "" || p.AuthBasicPasswordFile != "" {
+			return errors.New("auth_basic_username is required with auth_basic_password")
+		}
 		return nil
 	}
 
-	authBasic := p.AuthBasic
-	userPassInfo := strings.Split(authBasic, ":")
+	if p.AuthBasic != "" {
+		if p.AuthBasicUsername != "" || p.AuthBasicPassword != "" || p.AuthBasicPasswordFile != "" {
+			return errors.New("auth_basic cannot be combined with auth_basic_username or auth_basic_password")
+		}
+
+		userPassInfo := strings.SplitN(p.AuthBasic, ":", 2)
+		if len(userPassInfo) != 2 {
+			return errors.New("invalid auth_basic format, expected user:pass")
+		}
+
+		p.AuthUser = userPassInfo[0]
+		p.AuthPass = userPassInfo[1]
+	} else {
+		if p.AuthBasicPassword != "" && p.AuthBasicPasswordFile != "" {
+			return errors.New("auth_basic_password and auth_basic_password_file cannot both be set")
+		}
+
+		p.AuthUser = p.AuthBasicUsername
+		p.AuthPass = p.AuthBasicPassword
 
-	if len(userPassInfo) != 2 {
-		return errors.New("invalid auth_basic format")
+		if p.AuthBasicPasswordFile != "" {
+			password, err := os.ReadFile(p.AuthBasicPasswordFile)
+			if err != nil {
+				return errors.New("cannot read auth_basic_password_file: " + err.Error())
+			}
+			p.AuthPass = strings.TrimRight(string(password), "\r\n")
+		}
+	}
+
+	if p.AuthUser == "" {
+		return errors.New("auth_basic user is empty")
 	}
 
-	p.AuthUser = userPassInfo[0]
-	p.AuthPass = userPassInfo[1]
+	if p.AuthPass == "" && !p.AuthBasicAllowEmptyPassword {
+		return errors.New("auth_basic password is empty, set auth_basic_allow_empty_password to send it anyway")
+	}
 
 	return nil
 }
@@ -504,39 +984,46 @@ func (p *Plugin) AddFileUploadDataAsMultiPart() error {
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
 
-	file, err := os.Open(p.uploadFileAbsolutePath)
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
-	}
-	defer func() {
-		if file != nil {
-			err := file.Close()
-			if err != nil {
-				return
-			}
+	var content io.Reader
+
+	if p.TemplateUpload {
+		rendered, err := p.RenderUploadFile()
+		if err != nil {
+			return err
+		}
+		content = rendered
+	} else {
+		file, err := os.Open(p.uploadFileAbsolutePath)
+		if err != nil {
+			return fmt.Errorf("error opening file: %v", err)
 		}
-	}()
+		defer func() {
+			if file != nil {
+				err := file.Close()
+				if err != nil {
+					return
+				}
+			}
+		}()
+		content = file
+	}
 
 	part, err := writer.CreateFormFile(p.MultiPartName, filepath.Base(p.uploadFileAbsolutePath))
 	if err != nil {
 		return fmt.Errorf("error creating form file: %v", err)
 	}
-	defer func() {
-		if writer == nil {
-			return
-		}
-		err := writer.Close()
-		if err != nil {
-			return
-		}
-	}()
 
-	_, err = io.Copy(part, file)
+	_, err = io.Copy(part, content)
 	if err != nil {
 		return fmt.Errorf("error copying file content: %v", err)
 	}
 
-	p.BodyIoReader = &body
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("error closing multipart writer: %v", err)
+	}
+
+	p.BodyIoReader = bytes.NewReader(body.Bytes())
 	p.ContentType = writer.FormDataContentType()
 
 	return nil
@@ -544,6 +1031,16 @@ func (p *Plugin) AddFileUploadDataAsMultiPart() error {
 
 func (p *Plugin) AddFileUploadDataWithoutMultiPart() error {
 
+	if p.TemplateUpload {
+		rendered, err := p.RenderUploadFile()
+		if err != nil {
+			return err
+		}
+		p.BodyIoReader = rendered
+		p.ContentType = ApplicationOctetStream
+		return nil
+	}
+
 	file, err := os.Open(p.uploadFileAbsolutePath)
 	if err != nil {
 		LogPrintln(p, "error opening file: ", err.Error())
@@ -54,6 +54,53 @@ var enableTests = map[string]bool{
 	"TestGetRequestWithAcceptType":          true,
 	"TestGetRequestWithIncorrectAcceptType": true,
 
+	"TestParseResponseCodePolicy":             true,
+	"TestValidResponseCodesWithLocalServer":   true,
+	"TestResponseBodyMatchersWithLocalServer": true,
+	"TestJsonAssertions":                      true,
+	"TestJsonAssertionsWithLocalServer":       true,
+	"TestHeaderAssertions":                    true,
+	"TestHeaderAssertionsWithLocalServer":     true,
+	"TestJsonSchemaValidation":                true,
+	"TestResponseSchemaWithLocalServer":       true,
+	"TestRetryWithLocalServer":                true,
+	"TestRetryConnectionErrors":               true,
+	"TestRetryOnConnectionError":              true,
+	"TestRetryBackoffSettings":                true,
+	"TestPollUntilValidWithLocalServer":       true,
+	"TestPollTimeoutWithLocalServer":          true,
+	"TestRequestSequenceWithLocalServer":      true,
+	"TestRequestSequenceFromYamlFile":         true,
+	"TestBatchUrlsWithLocalServer":            true,
+	"TestBatchRequestSpecsWithLocalServer":    true,
+	"TestTemplatesWithLocalServer":            true,
+	"TestTemplateUploadWithLocalServer":       true,
+	"TestAuthTokensWithLocalServer":           true,
+	"TestAuthTokenRedaction":                  true,
+	"TestOAuth2WithLocalServer":               true,
+	"TestOAuth2TokenErrors":                   true,
+	"TestAwsCanonicalUri":                     true,
+	"TestAwsSigv4Signature":                   true,
+	"TestAwsSigv4WithLocalServer":             true,
+	"TestHmacSignatureWithLocalServer":        true,
+	"TestParseAuthChallenges":                 true,
+	"TestDigestAuthWithLocalServer":           true,
+	"TestNtlmMessages":                        true,
+	"TestNtlmAuthWithLocalServer":             true,
+	"TestAuthBasicWithLocalServer":            true,
+	"TestJwtWithLocalServer":                  true,
+	"TestClientTlsWithLocalServer":            true,
+	"TestClientPkcs12WithLocalServer":         true,
+	"TestAuthCertIsSslCertPath":               true,
+	"TestTransportBuilderCombinations":        true,
+	"TestTransportBuilderWithLocalProxy":      true,
+	"TestDurationSecondsDecode":               true,
+	"TestTimeoutsWithLocalServer":             true,
+	"TestTlsPolicyWithLocalServer":            true,
+	"TestTlsPinOutsideVerifiedChain":          true,
+	"TestProxySettingsWithLocalProxy":         true,
+	"TestSocks5ProxyWithLocalServer":          true,
+
 	//"TestSSlRequiredNoClientCertNoProxy": true,
 	//"TestSSlRequiredClientCertNoProxy":   true,
 	//"TestSslSkippingNoClientCertNoProxy": true,
@@ -0,0 +1,105 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const DefaultPollInterval = 10 * time.Second
+
+// ValidatePoll enables poll mode when poll_timeout is set, poll_interval
+// defaults to 10 seconds.
+func (p *Plugin) ValidatePoll() error {
+
+	p.pollInterval = 0
+	p.pollTimeout = 0
+
+	if p.PollTimeout == "" {
+		if p.PollInterval != "" {
+			return errors.New("poll_interval requires poll_timeout")
+		}
+		return nil
+	}
+
+	var err error
+	p.pollTimeout, err = ParseDurationSetting(p.PollTimeout)
+	if err != nil {
+		return errors.New("invalid poll_timeout: " + err.Error())
+	}
+	if p.pollTimeout == 0 {
+		return errors.New("poll_timeout must be greater than zero")
+	}
+
+	p.pollInterval = DefaultPollInterval
+	if p.PollInterval != "" {
+		p.pollInterval, err = ParseDurationSetting(p.PollInterval)
+		if err != nil {
+			return errors.New("invalid poll_interval: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) IsPollMode() bool {
+	return p.pollTimeout > 0
+}
+
+// PollUntilValidResponse repeats the request every poll_interval until
+// the response passes ValidateHttpResponse or poll_timeout expires.
+// Failed requests and failed checks both count as a pending attempt.
+// Each attempt is cut off at the poll deadline, set in DoRequest, so a
+// hanging request cannot outlast poll_timeout.
+func (p *Plugin) PollUntilValidResponse() error {
+
+	deadline := p.pollDeadline
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+
+		if attempt > 1 {
+			if time.Until(deadline) <= 0 {
+				return fmt.Errorf("poll_timeout %s expired after %d attempts, last error: %v", p.pollTimeout, attempt-1, err)
+			}
+			if err := p.RewindRequestBody(); err != nil {
+				return err
+			}
+			if err := p.PrepareHttpRequest(); err != nil {
+				return err
+			}
+		}
+
+		err = p.SendHttpRequest()
+		if err == nil {
+			p.isConnectionOpen = true
+			err = p.ValidateHttpResponse()
+		}
+
+		status := "no response"
+		if p.httpResponse != nil {
+			status = "status " + strconv.Itoa(p.httpResponse.StatusCode)
+		}
+
+		if err == nil {
+			LogPrintf(p, "poll attempt %d: %s, response is valid\n", attempt, status)
+			return nil
+		}
+
+		LogPrintf(p, "poll attempt %d: %s, %s\n", attempt, status, err.Error())
+
+		if time.Now().Add(p.pollInterval).After(deadline) {
+			return fmt.Errorf("poll_timeout %s expired after %d attempts, last error: %v", p.pollTimeout, attempt, err)
+		}
+
+		p.discardHttpResponse()
+		p.isConnectionOpen = false
+		time.Sleep(p.pollInterval)
+	}
+}
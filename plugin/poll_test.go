@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollUntilValidWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestPollUntilValidWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestPollUntilValidWithLocalServer test")
+	}
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch {
+		case attempts <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case attempts <= 4:
+			w.Write([]byte(`{"status":"DEPLOYING"}`))
+		default:
+			w.Write([]byte(`{"status":"UP"}`))
+		}
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:          ts.URL,
+			HttpMethod:   "GET",
+			AssertJson:   `$.status == "UP"`,
+			PollInterval: "10ms",
+			PollTimeout:  "5s",
+			Quiet:        true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err != nil {
+		t.Fatalf("Run() returned an error: %v", err)
+	}
+	if attempts != 5 {
+		t.Errorf("Expected 5 attempts, got %d", attempts)
+	}
+	if plugin.ResponseContent != `{"status":"UP"}` {
+		t.Errorf("Expected the final response to be stored, got %q", plugin.ResponseContent)
+	}
+}
+
+func TestPollTimeoutWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestPollTimeoutWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestPollTimeoutWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"DEPLOYING"}`))
+	}))
+	defer ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:               ts.URL,
+			HttpMethod:        "GET",
+			ValidResponseBody: `"UP"`,
+			PollInterval:      "20ms",
+			PollTimeout:       "100ms",
+			Quiet:             true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected poll_timeout to expire, but Run() returned no error")
+	}
+	if !strings.Contains(err.Error(), "poll_timeout 100ms expired") ||
+		!strings.Contains(err.Error(), "does not contain the expected string") {
+		t.Errorf("Expected the timeout and the last failure in the error, got: %v", err)
+	}
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer hanging.Close()
+
+	args.Url = hanging.URL
+	args.Timeout = 30
+	args.PollTimeout = "200ms"
+
+	plugin = GetNewPlugin(args)
+	started := time.Now()
+	err = plugin.Run()
+	plugin.DeInit()
+
+	if err == nil || !strings.Contains(err.Error(), "poll_timeout 200ms expired after 1 attempts") {
+		t.Errorf("Expected the hanging attempt to be cut off by poll_timeout, got: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected poll_timeout to bound a hanging request, took %s", elapsed)
+	}
+
+	args.PollTimeout = "300ms"
+	args.PollInterval = "100ms"
+	args.Retries = 4
+	args.RetryBackoff = "400ms/2s"
+
+	plugin = GetNewPlugin(args)
+	started = time.Now()
+	err = plugin.Run()
+	plugin.DeInit()
+
+	if err == nil || !strings.Contains(err.Error(), "poll_timeout 300ms expired") {
+		t.Errorf("Expected poll_timeout to expire with retries set, got: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected poll_timeout to bound the retries of a hanging request, took %s", elapsed)
+	}
+
+	plugin = GetNewPlugin(Args{PluginInputParams: PluginInputParams{Url: ts.URL, PollInterval: "1s"}})
+	if err := plugin.ValidatePoll(); err == nil {
+		t.Errorf("Expected poll_interval without poll_timeout to be rejected")
+	}
+}
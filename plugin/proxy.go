@@ -0,0 +1,221 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	ProxySocks5  = "socks5"
+	ProxySocks5h = "socks5h"
+)
+
+/*
+	proxy sends every request through the proxy. proxy_from_env takes
+	the proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY instead, they are
+	ignored otherwise. no_proxy lists the hosts that bypass the proxy,
+	in the NO_PROXY format, added to NO_PROXY with proxy_from_env:
+
+	no_proxy: .corp.example.com,10.0.0.0/8,artifacts:8081
+
+	With a bypass list, loopback addresses bypass the proxy as well.
+	proxy_user and proxy_password are sent to the proxy as
+	Proxy-Authorization, unless the proxy url has its own credentials.
+
+	A socks5:// or socks5h:// proxy tunnels the connections instead, as
+	an ssh -D tunnel does, with the same bypass list and credentials.
+	socks5 resolves the host names locally, socks5h on the proxy side.
+*/
+
+// ValidateProxy checks the proxy settings and builds the function that
+// picks the proxy of a request.
+func (p *Plugin) ValidateProxy() error {
+
+	p.proxyUrl = nil
+	p.proxyFunc = nil
+
+	if p.Proxy != "" && p.ProxyFromEnv {
+		return errors.New("proxy cannot be combined with proxy_from_env")
+	}
+
+	if p.Proxy == "" && !p.ProxyFromEnv {
+		if p.NoProxy != "" || p.ProxyUser != "" || p.ProxyPassword != "" {
+			return errors.New("no_proxy, proxy_user and proxy_password need proxy or proxy_from_env")
+		}
+		return nil
+	}
+
+	if p.ProxyUser == "" && p.ProxyPassword != "" {
+		return errors.New("proxy_user is required with proxy_password")
+	}
+
+	var proxyFunc func(*url.URL) (*url.URL, error)
+
+	if p.ProxyFromEnv {
+		config := httpproxy.FromEnvironment()
+		if p.NoProxy != "" {
+			config.NoProxy = strings.Trim(config.NoProxy+","+p.NoProxy, ",")
+		}
+		proxyFunc = config.ProxyFunc()
+	} else {
+		proxy, err := url.Parse(p.Proxy)
+		if err != nil {
+			return errors.New("invalid proxy URL: " + err.Error())
+		}
+		if proxy.Host == "" {
+			return errors.New("invalid proxy URL " + p.Proxy + ", expected scheme://host:port")
+		}
+		switch proxy.Scheme {
+		case "http", "https", ProxySocks5, ProxySocks5h:
+		default:
+			return errors.New("unsupported proxy scheme " + proxy.Scheme + ", expected http, https, socks5 or socks5h")
+		}
+		p.proxyUrl = proxy
+
+		if p.NoProxy != "" {
+			config := &httpproxy.Config{HTTPProxy: p.Proxy, HTTPSProxy: p.Proxy, NoProxy: p.NoProxy}
+			proxyFunc = config.ProxyFunc()
+		} else {
+			proxyFunc = func(*url.URL) (*url.URL, error) {
+				return proxy, nil
+			}
+		}
+	}
+
+	p.proxyFunc = func(target *url.URL) (*url.URL, error) {
+		proxy, err := proxyFunc(target)
+		if err != nil || proxy == nil || p.ProxyUser == "" || proxy.User != nil {
+			return proxy, err
+		}
+		authenticated := *proxy
+		authenticated.User = url.UserPassword(p.ProxyUser, p.ProxyPassword)
+		return &authenticated, nil
+	}
+
+	return nil
+}
+
+// SetTransportProxy sends the requests through the proxy, if any.
+func (p *Plugin) SetTransportProxy(transport *http.Transport) error {
+
+	if p.proxyFunc == nil {
+		if err := p.ValidateProxy(); err != nil {
+			return err
+		}
+	}
+
+	if p.proxyFunc == nil {
+		return nil
+	}
+
+	if p.proxyUrl != nil && (p.proxyUrl.Scheme == ProxySocks5 || p.proxyUrl.Scheme == ProxySocks5h) {
+		return p.setSocksDialer(transport)
+	}
+
+	proxyFunc := p.proxyFunc
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	return nil
+}
+
+// setSocksDialer dials the connections through the SOCKS5 proxy, on top
+// of the dialer of the transport. socks5 resolves the host names
+// locally, socks5h leaves that to the proxy.
+func (p *Plugin) setSocksDialer(transport *http.Transport) error {
+
+	forward := transport.DialContext
+	if forward == nil {
+		forward = (&net.Dialer{Timeout: DefaultConnectTimeout}).DialContext
+	}
+
+	var auth *proxy.Auth
+	if p.proxyUrl.User != nil {
+		password, _ := p.proxyUrl.User.Password()
+		auth = &proxy.Auth{User: p.proxyUrl.User.Username(), Password: password}
+	} else if p.ProxyUser != "" {
+		auth = &proxy.Auth{User: p.ProxyUser, Password: p.ProxyPassword}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", p.proxyUrl.Host, auth, contextDialer(forward))
+	if err != nil {
+		return errors.New("invalid socks proxy: " + err.Error())
+	}
+	socks, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return errors.New("socks proxy dialer does not support contexts")
+	}
+
+	resolveLocally := p.proxyUrl.Scheme == ProxySocks5
+	proxyFunc := p.proxyFunc
+
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+
+		via, err := proxyFunc(&url.URL{Scheme: "http", Host: address})
+		if err != nil {
+			return nil, err
+		}
+		if via == nil {
+			return forward(ctx, network, address)
+		}
+
+		if resolveLocally {
+			host, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			if net.ParseIP(host) == nil {
+				addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+				if err != nil {
+					return nil, err
+				}
+				address = net.JoinHostPort(addresses[0].IP.String(), port)
+			}
+		}
+
+		return socks.DialContext(ctx, network, address)
+	}
+
+	return nil
+}
+
+// contextDialer makes a dial function a proxy.Dialer that keeps the
+// context.
+type contextDialer func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (d contextDialer) Dial(network, address string) (net.Conn, error) {
+	return d(context.Background(), network, address)
+}
+
+func (d contextDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d(ctx, network, address)
+}
+
+// proxyUrlPassword is the password of the proxy url itself, if any.
+func proxyUrlPassword(proxy string) string {
+
+	if proxy == "" {
+		return ""
+	}
+
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.User == nil {
+		return ""
+	}
+
+	password, _ := proxyUrl.User.Password()
+	return password
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxySettingsWithLocalProxy(t *testing.T) {
+
+	_, found := enableTests["TestProxySettingsWithLocalProxy"]
+	if !found {
+		t.Skip("Skipping TestProxySettingsWithLocalProxy test")
+	}
+
+	var proxied []string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("builder:pr0xy-s3cret"))
+		if r.Header.Get("Proxy-Authorization") != expected {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="corp"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied = append(proxied, r.URL.Host)
+	}))
+	defer proxy.Close()
+
+	run := func(target string, params PluginInputParams) error {
+		params.Url = "http://" + target + "/status"
+		params.HttpMethod = "GET"
+		params.Timeout = 5
+		params.Quiet = true
+		return Exec(context.Background(), Args{PluginInputParams: params})
+	}
+
+	credentials := PluginInputParams{Proxy: proxy.URL, ProxyUser: "builder", ProxyPassword: "pr0xy-s3cret"}
+
+	if err := run("public.invalid", credentials); err != nil {
+		t.Fatalf("Exec() through the authenticating proxy returned an error: %v", err)
+	}
+
+	withUserInUrl := PluginInputParams{Proxy: strings.Replace(proxy.URL, "://", "://builder:pr0xy-s3cret@", 1)}
+	if err := run("public.invalid", withUserInUrl); err != nil {
+		t.Fatalf("Exec() with credentials in the proxy url returned an error: %v", err)
+	}
+
+	if err := run("public.invalid", PluginInputParams{Proxy: proxy.URL}); err == nil {
+		t.Errorf("Expected the proxy to refuse a request without credentials")
+	}
+
+	bypass := credentials
+	bypass.NoProxy = ".corp.invalid,internal.invalid"
+	if err := run("public.invalid", bypass); err != nil {
+		t.Fatalf("Exec() with no_proxy returned an error: %v", err)
+	}
+	if err := run("build.corp.invalid", bypass); err == nil {
+		t.Errorf("Expected build.corp.invalid to bypass the proxy and fail to resolve")
+	}
+
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "internal.invalid")
+
+	fromEnv := PluginInputParams{ProxyFromEnv: true, ProxyUser: "builder", ProxyPassword: "pr0xy-s3cret"}
+	if err := run("public.invalid", fromEnv); err != nil {
+		t.Fatalf("Exec() with proxy_from_env returned an error: %v", err)
+	}
+	if err := run("internal.invalid", fromEnv); err == nil {
+		t.Errorf("Expected internal.invalid to bypass the proxy of the environment")
+	}
+	fromEnv.NoProxy = "public.invalid"
+	if err := run("public.invalid", fromEnv); err == nil {
+		t.Errorf("Expected no_proxy to add to NO_PROXY")
+	}
+
+	if err := run("public.invalid", PluginInputParams{}); err == nil {
+		t.Errorf("Expected the proxy of the environment to be ignored without proxy_from_env")
+	}
+
+	expected := []string{"public.invalid", "public.invalid", "public.invalid", "public.invalid"}
+	if strings.Join(proxied, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the proxy to see %v, got %v", expected, proxied)
+	}
+
+	plugin := GetNewPlugin(Args{PluginInputParams: withUserInUrl})
+	if redacted := plugin.RedactSecrets("proxy " + withUserInUrl.Proxy); strings.Contains(redacted, "pr0xy-s3cret") {
+		t.Errorf("Expected the proxy password to be redacted, got %s", redacted)
+	}
+
+	invalid := []PluginInputParams{
+		{Proxy: proxy.URL, ProxyFromEnv: true},
+		{NoProxy: "internal.invalid"},
+		{ProxyUser: "builder"},
+		{Proxy: proxy.URL, ProxyPassword: "pr0xy-s3cret"},
+		{Proxy: "not a url"},
+	}
+	for i, params := range invalid {
+		if err := run("public.invalid", params); err == nil {
+			t.Errorf("Expected invalid settings %d to be rejected", i)
+		}
+	}
+}
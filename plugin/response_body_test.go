@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseBodyMatchersWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestResponseBodyMatchersWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestResponseBodyMatchersWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{\n\"service\":\"api\",\n\"status\":\"FAILED\"\n}"))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name                string
+		validResponseRegex  string
+		invalidResponseBody string
+		wantErr             bool
+	}{
+		{name: "Regex matches", validResponseRegex: `^"service":"\w+",$`, wantErr: false},
+		{name: "Regex does not match", validResponseRegex: `^"status":"UP"$`, wantErr: true},
+		{name: "Invalid string present", invalidResponseBody: `"status":"FAILED"`, wantErr: true},
+		{name: "Invalid string absent", invalidResponseBody: `"status":"ERROR"`, wantErr: false},
+		{name: "Invalid regex present", invalidResponseBody: `/"status":"(FAILED|ERROR)"/`, wantErr: true},
+		{name: "Invalid regex absent", invalidResponseBody: `/"status":"DOWN"/`, wantErr: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := Args{
+				PluginInputParams: PluginInputParams{
+					Url:                 ts.URL,
+					HttpMethod:          "GET",
+					ValidResponseRegex:  tc.validResponseRegex,
+					InvalidResponseBody: tc.invalidResponseBody,
+					Quiet:               true,
+				},
+			}
+
+			plugin := GetNewPlugin(args)
+			err := plugin.Run()
+			defer plugin.DeInit()
+
+			if tc.wantErr && err == nil {
+				t.Errorf("Expected an error, but Run() returned none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Run() returned an error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultValidResponseCodes matches the default of the Jenkins
+// httpRequest step, which treats redirects as successful.
+const DefaultValidResponseCodes = "100:399"
+
+// ResponseCodeRange is an inclusive range of http status codes.
+type ResponseCodeRange struct {
+	From int
+	To   int
+}
+
+func (r ResponseCodeRange) Contains(statusCode int) bool {
+	return statusCode >= r.From && statusCode <= r.To
+}
+
+// ResponseCodePolicy is the parsed form of valid_response_codes.
+//
+// The syntax follows the Jenkins httpRequest step, a comma separated
+// list of single codes (304) and inclusive ranges (200:299), and also
+// accepts class wildcards such as 2xx.
+type ResponseCodePolicy struct {
+	Spec   string
+	Ranges []ResponseCodeRange
+}
+
+func ParseResponseCodePolicy(spec string) (*ResponseCodePolicy, error) {
+
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty response code list")
+	}
+
+	policy := &ResponseCodePolicy{Spec: spec}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, errors.New("empty entry in response code list " + spec)
+		}
+
+		codeRange, err := parseResponseCodeRange(item)
+		if err != nil {
+			return nil, err
+		}
+		policy.Ranges = append(policy.Ranges, codeRange)
+	}
+
+	return policy, nil
+}
+
+func parseResponseCodeRange(item string) (ResponseCodeRange, error) {
+
+	lower := strings.ToLower(item)
+	if len(lower) == 3 && strings.HasSuffix(lower, "xx") {
+		class, err := strconv.Atoi(lower[:1])
+		if err != nil || class < 1 || class > 5 {
+			return ResponseCodeRange{}, errors.New("invalid response code class " + item)
+		}
+		return ResponseCodeRange{From: class * 100, To: class*100 + 99}, nil
+	}
+
+	if strings.Contains(item, ":") {
+		bounds := strings.SplitN(item, ":", 2)
+		from, err := parseResponseCode(bounds[0])
+		if err != nil {
+			return ResponseCodeRange{}, err
+		}
+		to, err := parseResponseCode(bounds[1])
+		if err != nil {
+			return ResponseCodeRange{}, err
+		}
+		if from > to {
+			return ResponseCodeRange{}, errors.New("invalid response code range " + item)
+		}
+		return ResponseCodeRange{From: from, To: to}, nil
+	}
+
+	code, err := parseResponseCode(item)
+	if err != nil {
+		return ResponseCodeRange{}, err
+	}
+	return ResponseCodeRange{From: code, To: code}, nil
+}
+
+func parseResponseCode(codeStr string) (int, error) {
+	codeStr = strings.TrimSpace(codeStr)
+	code, err := strconv.Atoi(codeStr)
+	if err != nil || code < 100 || code > 599 {
+		return 0, errors.New("invalid response code " + codeStr)
+	}
+	return code, nil
+}
+
+func (rp *ResponseCodePolicy) IsValid(statusCode int) bool {
+	for _, codeRange := range rp.Ranges {
+		if codeRange.Contains(statusCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp *ResponseCodePolicy) Check(statusCode int) error {
+	if rp.IsValid(statusCode) {
+		return nil
+	}
+	return fmt.Errorf("response status %d is not one of the valid response codes %s", statusCode, rp.Spec)
+}
+
+func (p *Plugin) ValidateResponseCodes() error {
+
+	spec := p.ValidResponseCodes
+	if spec == "" {
+		spec = DefaultValidResponseCodes
+	}
+
+	policy, err := ParseResponseCodePolicy(spec)
+	if err != nil {
+		return err
+	}
+
+	p.responseCodePolicy = policy
+	return nil
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseResponseCodePolicy(t *testing.T) {
+
+	_, found := enableTests["TestParseResponseCodePolicy"]
+	if !found {
+		t.Skip("Skipping TestParseResponseCodePolicy test")
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		valid   []int
+		invalid []int
+		wantErr bool
+	}{
+		{name: "Jenkins range", spec: "200:299", valid: []int{200, 250, 299}, invalid: []int{199, 300}},
+		{name: "Range and codes", spec: "200:299,304, 401", valid: []int{204, 304, 401}, invalid: []int{302, 400, 500}},
+		{name: "Class wildcard", spec: "2xx,404", valid: []int{200, 299, 404}, invalid: []int{301, 500}},
+		{name: "Upper case class", spec: "5XX", valid: []int{503}, invalid: []int{404}},
+		{name: "Empty entry", spec: "200,,201", wantErr: true},
+		{name: "Reversed range", spec: "299:200", wantErr: true},
+		{name: "Out of bounds", spec: "700", wantErr: true},
+		{name: "Bad class", spec: "9xx", wantErr: true},
+		{name: "Not a number", spec: "ok", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ParseResponseCodePolicy(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error for %q, but got none", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect an error for %q, but got: %v", tc.spec, err)
+			}
+			for _, code := range tc.valid {
+				if !policy.IsValid(code) {
+					t.Errorf("Expected %d to be valid for %q", code, tc.spec)
+				}
+			}
+			for _, code := range tc.invalid {
+				if policy.IsValid(code) {
+					t.Errorf("Expected %d to be invalid for %q", code, tc.spec)
+				}
+			}
+		})
+	}
+}
+
+func TestValidResponseCodesWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestValidResponseCodesWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestValidResponseCodesWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		validCodes string
+		wantErr    bool
+	}{
+		{name: "Default accepts 200", path: "/", validCodes: "", wantErr: false},
+		{name: "Default rejects 404", path: "/missing", validCodes: "", wantErr: true},
+		{name: "Explicit 404", path: "/missing", validCodes: "200:299,404", wantErr: false},
+		{name: "Only 201", path: "/", validCodes: "201", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := Args{
+				PluginInputParams: PluginInputParams{
+					Url:                ts.URL + tc.path,
+					HttpMethod:         "GET",
+					ValidResponseCodes: tc.validCodes,
+					Quiet:              true,
+				},
+			}
+
+			plugin := GetNewPlugin(args)
+			err := plugin.Run()
+			defer plugin.DeInit()
+
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error for valid codes %q, but got none", tc.validCodes)
+				}
+				if !strings.Contains(err.Error(), "404") && !strings.Contains(err.Error(), "200") {
+					t.Errorf("Expected the error to name the received status, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() returned an error: %v", err)
+			}
+		})
+	}
+}
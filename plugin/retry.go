@@ -0,0 +1,298 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryOn           = "429,502,503,504,timeout,connection-error"
+	DefaultRetryInitialDelay = 1 * time.Second
+	DefaultRetryMaxDelay     = 30 * time.Second
+
+	RetryOnTimeout         = "timeout"
+	RetryOnConnectionError = "connection-error"
+)
+
+type RetryPolicy struct {
+	InitialDelay      time.Duration
+	MaxDelay          time.Duration
+	StatusCodes       *ResponseCodePolicy
+	OnTimeout         bool
+	OnConnectionError bool
+}
+
+// ValidateRetry parses retry_backoff, written as initial/max delay such
+// as 1s/30s, and retry_on, a list of response codes in the
+// valid_response_codes syntax plus the keywords timeout and
+// connection-error.
+func (p *Plugin) ValidateRetry() error {
+
+	p.retryPolicy = nil
+
+	if p.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	if p.Retries == 0 {
+		return nil
+	}
+
+	policy := &RetryPolicy{
+		InitialDelay: DefaultRetryInitialDelay,
+		MaxDelay:     DefaultRetryMaxDelay,
+	}
+
+	if p.RetryBackoff != "" {
+		delays := strings.SplitN(p.RetryBackoff, "/", 2)
+
+		var err error
+		policy.InitialDelay, err = ParseDurationSetting(delays[0])
+		if err != nil {
+			return errors.New("invalid retry_backoff: " + err.Error())
+		}
+
+		if len(delays) == 2 {
+			policy.MaxDelay, err = ParseDurationSetting(delays[1])
+			if err != nil {
+				return errors.New("invalid retry_backoff: " + err.Error())
+			}
+		} else if policy.InitialDelay > policy.MaxDelay {
+			policy.MaxDelay = policy.InitialDelay
+		}
+
+		if policy.InitialDelay > policy.MaxDelay {
+			return errors.New("invalid retry_backoff: initial delay is greater than max delay")
+		}
+	}
+
+	retryOn := p.RetryOn
+	if retryOn == "" {
+		retryOn = DefaultRetryOn
+	}
+
+	var codes []string
+	for _, item := range strings.Split(retryOn, ",") {
+		item = strings.TrimSpace(item)
+		switch strings.ToLower(item) {
+		case RetryOnTimeout:
+			policy.OnTimeout = true
+		case RetryOnConnectionError:
+			policy.OnConnectionError = true
+		default:
+			codes = append(codes, item)
+		}
+	}
+
+	if len(codes) > 0 {
+		var err error
+		policy.StatusCodes, err = ParseResponseCodePolicy(strings.Join(codes, ","))
+		if err != nil {
+			return errors.New("invalid retry_on: " + err.Error())
+		}
+	}
+
+	p.retryPolicy = policy
+	return nil
+}
+
+// retryReason returns why an attempt should be retried, or an empty
+// string when its outcome is final.
+func (p *Plugin) retryReason(resp *http.Response, err error) string {
+
+	policy := p.retryPolicy
+	if policy == nil {
+		return ""
+	}
+
+	if err != nil {
+		if isTimeoutError(err) {
+			if policy.OnTimeout {
+				return "timeout"
+			}
+			return ""
+		}
+		if policy.OnConnectionError && isConnectionError(err) {
+			return "connection error: " + err.Error()
+		}
+		return ""
+	}
+
+	if resp != nil && policy.StatusCodes != nil && policy.StatusCodes.IsValid(resp.StatusCode) {
+		return "response status " + strconv.Itoa(resp.StatusCode)
+	}
+
+	return ""
+}
+
+// retryDelay doubles the initial delay for every attempt up to the max
+// delay and picks a random point in its upper half, so that parallel
+// steps hitting the same API spread out. A Retry-After header from the
+// server takes precedence when it asks for a longer wait. It is never
+// shortened, when it asks for more than the max delay there is no retry
+// and false is returned.
+func (p *Plugin) retryDelay(attempt int, resp *http.Response) (time.Duration, bool) {
+
+	policy := p.retryPolicy
+
+	delay := policy.InitialDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	if delay > 0 {
+		half := int64(delay / 2)
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok && retryAfter > delay {
+			if retryAfter > policy.MaxDelay {
+				return retryAfter, false
+			}
+			delay = retryAfter
+		}
+	}
+
+	return delay, true
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
+
+func isTimeoutError(err error) bool {
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// isConnectionError reports whether the request failed to reach the
+// server or lost its connection, which another attempt may fix.
+// Certificate, pin, token and auth errors are final, as are proxy and
+// socks handshake failures, which come wrapped in a net.OpError as well
+// but do not carry a network error of their own.
+func isConnectionError(err error) bool {
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+
+	cause := opErr.Err
+	for {
+		inner, ok := cause.(*net.OpError)
+		if !ok {
+			break
+		}
+		cause = inner.Err
+	}
+
+	var syscallErr *os.SyscallError
+	var errno syscall.Errno
+	return errors.As(cause, &syscallErr) || errors.As(cause, &errno)
+}
+
+// discardHttpResponse drains and closes a response that is going to be
+// retried so that its connection can be reused.
+func (p *Plugin) discardHttpResponse() {
+
+	if p.httpResponse == nil {
+		return
+	}
+
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(p.httpResponse.Body, 1<<20))
+	_ = p.httpResponse.Body.Close()
+	p.httpResponse = nil
+}
+
+// RewindRequestBody seeks the request body back to its start so that
+// it can be sent again. Bodies built by ValidateRequestBody are always
+// seekable.
+func (p *Plugin) RewindRequestBody() error {
+
+	if p.BodyIoReader == nil {
+		return nil
+	}
+
+	seeker, ok := p.BodyIoReader.(io.Seeker)
+	if !ok {
+		return errors.New("request body cannot be rewound for another attempt")
+	}
+
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// HashRequestBody writes the request body into h and rewinds it, so
+// that signatures cover the exact bytes that are sent.
+func (p *Plugin) HashRequestBody(h hash.Hash) error {
+
+	if p.BodyIoReader == nil {
+		return nil
+	}
+
+	err := p.RewindRequestBody()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(h, p.BodyIoReader)
+	if err != nil {
+		return err
+	}
+
+	return p.RewindRequestBody()
+}
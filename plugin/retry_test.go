@@ -0,0 +1,305 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestRetryWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestRetryWithLocalServer test")
+	}
+
+	filePath := filepath.Join(t.TempDir(), "retry-upload.txt")
+	if err := os.WriteFile(filePath, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		args            PluginInputParams
+		failures        int
+		failureStatus   int
+		retryAfter      string
+		expectedBody    string
+		expectedAttempt int
+		wantErr         bool
+	}{
+		{
+			name:            "Request body",
+			args:            PluginInputParams{HttpMethod: "POST", RequestBody: `{"name":"drone"}`, Retries: 3},
+			failures:        2,
+			failureStatus:   http.StatusServiceUnavailable,
+			expectedBody:    `{"name":"drone"}`,
+			expectedAttempt: 3,
+		},
+		{
+			name:            "Direct file upload",
+			args:            PluginInputParams{HttpMethod: "PUT", UploadFile: filePath, Retries: 2},
+			failures:        1,
+			failureStatus:   http.StatusBadGateway,
+			expectedBody:    "test content",
+			expectedAttempt: 2,
+		},
+		{
+			name:            "Multipart file upload",
+			args:            PluginInputParams{HttpMethod: "POST", UploadFile: filePath, WrapAsMultipart: true, MultiPartName: "file", Retries: 2},
+			failures:        2,
+			failureStatus:   http.StatusTooManyRequests,
+			expectedAttempt: 3,
+		},
+		{
+			name:            "Retries exhausted",
+			args:            PluginInputParams{HttpMethod: "GET", Retries: 1},
+			failures:        5,
+			failureStatus:   http.StatusServiceUnavailable,
+			expectedAttempt: 2,
+			wantErr:         true,
+		},
+		{
+			name:            "Status not retried",
+			args:            PluginInputParams{HttpMethod: "GET", Retries: 3, RetryOn: "503"},
+			failures:        5,
+			failureStatus:   http.StatusInternalServerError,
+			expectedAttempt: 1,
+			wantErr:         true,
+		},
+		{
+			name:            "Retry-After above max delay",
+			args:            PluginInputParams{HttpMethod: "GET", Retries: 3},
+			failures:        5,
+			failureStatus:   http.StatusTooManyRequests,
+			retryAfter:      "60",
+			expectedAttempt: 1,
+			wantErr:         true,
+		},
+		{
+			name:            "Class wildcard",
+			args:            PluginInputParams{HttpMethod: "GET", Retries: 3, RetryOn: "5xx"},
+			failures:        1,
+			failureStatus:   http.StatusInternalServerError,
+			expectedAttempt: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+
+				if tc.args.WrapAsMultipart {
+					file, _, err := r.FormFile("file")
+					if err != nil {
+						t.Errorf("Attempt %d: expected multipart file, got error: %v", attempts, err)
+					} else {
+						content, _ := io.ReadAll(file)
+						if string(content) != "test content" {
+							t.Errorf("Attempt %d: expected 'test content', got %q", attempts, string(content))
+						}
+					}
+				} else if tc.expectedBody != "" {
+					content, _ := io.ReadAll(r.Body)
+					if string(content) != tc.expectedBody {
+						t.Errorf("Attempt %d: expected body %q, got %q", attempts, tc.expectedBody, string(content))
+					}
+				}
+
+				if attempts <= tc.failures {
+					retryAfter := tc.retryAfter
+					if retryAfter == "" {
+						retryAfter = "0"
+					}
+					w.Header().Set("Retry-After", retryAfter)
+					w.WriteHeader(tc.failureStatus)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+
+			args := tc.args
+			args.Url = ts.URL
+			args.RetryBackoff = "10ms/20ms"
+			args.Quiet = true
+
+			plugin := GetNewPlugin(Args{PluginInputParams: args})
+			err := plugin.Run()
+			defer plugin.DeInit()
+
+			if tc.wantErr && err == nil {
+				t.Errorf("Expected an error, but Run() returned none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Run() returned an error: %v", err)
+			}
+			if attempts != tc.expectedAttempt {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempt, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+
+	_, found := enableTests["TestRetryOnConnectionError"]
+	if !found {
+		t.Skip("Skipping TestRetryOnConnectionError test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedUrl := ts.URL
+	ts.Close()
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:          closedUrl,
+			HttpMethod:   "GET",
+			Retries:      2,
+			RetryBackoff: "10ms/10ms",
+			Quiet:        true,
+		},
+	}
+
+	plugin := GetNewPlugin(args)
+	start := time.Now()
+	err := plugin.Run()
+	defer plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected a connection error, but Run() returned none")
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected at least two backoff delays, but Run() returned after %s", elapsed)
+	}
+}
+
+func TestRetryConnectionErrors(t *testing.T) {
+
+	_, found := enableTests["TestRetryConnectionErrors"]
+	if !found {
+		t.Skip("Skipping TestRetryConnectionErrors test")
+	}
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+
+	tests := []struct {
+		err   error
+		retry bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: refused}, true},
+		{&net.OpError{Op: "proxyconnect", Net: "tcp", Err: refused}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, true},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, true},
+		{io.ErrUnexpectedEOF, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{&net.OpError{Op: "proxyconnect", Net: "tcp", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("username/password authentication failed")}, false},
+		{errors.New("no certificate of the server matches tls_pin_sha256"), false},
+		{errors.New("Proxy Authentication Required"), false},
+		{errors.New("oauth2 token request failed with status 401"), false},
+	}
+
+	plugin := GetNewPlugin(Args{PluginInputParams: PluginInputParams{Retries: 1}})
+	if err := plugin.ValidateRetry(); err != nil {
+		t.Fatalf("ValidateRetry() returned an error: %v", err)
+	}
+
+	for _, tc := range tests {
+		if retry := plugin.retryReason(nil, tc.err) != ""; retry != tc.retry {
+			t.Errorf("%v: expected retry %t, got %t", tc.err, tc.retry, retry)
+		}
+	}
+
+	handshakes := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			handshakes++
+		}
+	}
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	plugin = GetNewPlugin(Args{PluginInputParams: PluginInputParams{
+		Url:          ts.URL,
+		HttpMethod:   "GET",
+		Retries:      2,
+		RetryBackoff: "10ms/10ms",
+		Quiet:        true,
+	}})
+	err := plugin.Run()
+	plugin.DeInit()
+
+	if err == nil {
+		t.Fatalf("Expected the untrusted certificate to fail the request")
+	}
+	if handshakes != 1 {
+		t.Errorf("Expected a certificate error not to be retried, got %d connections", handshakes)
+	}
+}
+
+func TestRetryBackoffSettings(t *testing.T) {
+
+	_, found := enableTests["TestRetryBackoffSettings"]
+	if !found {
+		t.Skip("Skipping TestRetryBackoffSettings test")
+	}
+
+	plugin := GetNewPlugin(Args{PluginInputParams: PluginInputParams{Retries: 5, RetryBackoff: "100ms/1s"}})
+	if err := plugin.ValidateRetry(); err != nil {
+		t.Fatalf("ValidateRetry() returned an error: %v", err)
+	}
+
+	for attempt, maxDelay := range []time.Duration{0, 100, 200, 400, 800, 1000, 1000} {
+		if attempt == 0 {
+			continue
+		}
+		delay, _ := plugin.retryDelay(attempt, nil)
+		if delay < maxDelay*time.Millisecond/2 || delay > maxDelay*time.Millisecond {
+			t.Errorf("Attempt %d: expected delay within [%s, %s], got %s",
+				attempt, maxDelay*time.Millisecond/2, maxDelay*time.Millisecond, delay)
+		}
+	}
+
+	plugin.RetryBackoff = "100ms/10s"
+	if err := plugin.ValidateRetry(); err != nil {
+		t.Fatalf("ValidateRetry() returned an error: %v", err)
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if delay, ok := plugin.retryDelay(1, resp); !ok || delay != 3*time.Second {
+		t.Errorf("Expected Retry-After to set a 3s delay, got %s", delay)
+	}
+	resp.Header.Set("Retry-After", "86400")
+	if delay, ok := plugin.retryDelay(1, resp); ok {
+		t.Errorf("Expected a Retry-After above the max delay to stop the retries, got a %s delay", delay)
+	}
+
+	for _, backoff := range []string{"2s/1s", "fast", "1s/-1s"} {
+		plugin.RetryBackoff = backoff
+		if err := plugin.ValidateRetry(); err == nil {
+			t.Errorf("Expected retry_backoff %q to be rejected", backoff)
+		}
+	}
+
+	plugin.RetryBackoff = ""
+	plugin.RetryOn = "5xx,flaky"
+	if err := plugin.ValidateRetry(); err == nil {
+		t.Errorf("Expected retry_on %q to be rejected", plugin.RetryOn)
+	}
+}
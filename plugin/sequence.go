@@ -0,0 +1,226 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RequestSpec is one entry of the requests setting. Connection, proxy,
+// timeout and auth settings are inherited from the step, headers are
+// added to the step headers, everything else applies to this request
+// only. Capture maps a variable name to
+//
+//	$.json.path      first value selected from the json response body
+//	header:Name      value of a response header
+//	regex:pattern    first capture group, or the whole match, in the body
+//
+// and later requests use the variables as {{ .name }} in their url,
+// headers and body, which needs template to be set. Batch requests run
+// concurrently and cannot capture.
+type RequestSpec struct {
+	Name                string            `json:"name" yaml:"name"`
+	Url                 string            `json:"url" yaml:"url"`
+	HttpMethod          string            `json:"method" yaml:"method"`
+	Headers             string            `json:"headers" yaml:"headers"`
+	ContentType         string            `json:"content_type" yaml:"content_type"`
+	AcceptType          string            `json:"accept_type" yaml:"accept_type"`
+	RequestBody         string            `json:"body" yaml:"body"`
+	UploadFile          string            `json:"upload_file" yaml:"upload_file"`
+	MultiPartName       string            `json:"multipart_name" yaml:"multipart_name"`
+	WrapAsMultipart     bool              `json:"wrap_as_multipart" yaml:"wrap_as_multipart"`
+	OutputFile          string            `json:"output_file" yaml:"output_file"`
+	ValidResponseCodes  string            `json:"valid_response_codes" yaml:"valid_response_codes"`
+	ValidResponseBody   string            `json:"valid_response_body" yaml:"valid_response_body"`
+	ValidResponseRegex  string            `json:"valid_response_regex" yaml:"valid_response_regex"`
+	InvalidResponseBody string            `json:"invalid_response_body" yaml:"invalid_response_body"`
+	AssertJson          string            `json:"assert_json" yaml:"assert_json"`
+	AssertHeaders       string            `json:"assert_headers" yaml:"assert_headers"`
+	Capture             map[string]string `json:"capture" yaml:"capture"`
+}
+
+// LoadRequestSpecs reads the requests setting, either an inline yaml or
+// json list or the path of a file containing one.
+func LoadRequestSpecs(requests string) ([]RequestSpec, error) {
+
+	data := []byte(requests)
+
+	trimmed := strings.TrimSpace(requests)
+	if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "-") {
+		fileData, err := os.ReadFile(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("requests is neither a list nor a readable file: %v", err)
+		}
+		data = fileData
+	}
+
+	var specs []RequestSpec
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("invalid requests list: %v", err)
+	}
+
+	if len(specs) == 0 {
+		return nil, errors.New("requests list is empty")
+	}
+
+	for i := range specs {
+		if specs[i].Name == "" {
+			specs[i].Name = fmt.Sprintf("request %d", i+1)
+		}
+		if specs[i].Url == "" {
+			return nil, errors.New(specs[i].Name + ": url is required")
+		}
+	}
+
+	return specs, nil
+}
+
+// ToArgs returns the step args with the request fields replaced by the
+// fields of the spec.
+func (spec *RequestSpec) ToArgs(base Args) Args {
+
+	args := base
+	args.Requests = ""
+
+	args.Url = spec.Url
+	args.HttpMethod = spec.HttpMethod
+	args.ContentType = spec.ContentType
+	args.AcceptType = spec.AcceptType
+	args.RequestBody = spec.RequestBody
+	args.UploadFile = spec.UploadFile
+	args.MultiPartName = spec.MultiPartName
+	args.WrapAsMultipart = spec.WrapAsMultipart
+	args.OutputFile = spec.OutputFile
+	args.ValidResponseCodes = spec.ValidResponseCodes
+	args.ValidResponseBody = spec.ValidResponseBody
+	args.ValidResponseRegex = spec.ValidResponseRegex
+	args.InvalidResponseBody = spec.InvalidResponseBody
+	args.AssertJson = spec.AssertJson
+	args.AssertHeaders = spec.AssertHeaders
+
+	switch {
+	case base.Headers == "":
+		args.Headers = spec.Headers
+	case spec.Headers != "":
+		args.Headers = base.Headers + "," + spec.Headers
+	}
+
+	return args
+}
+
+// ExecSequence runs the requests in order, each as its own plugin,
+// and stops at the first one that fails.
+func ExecSequence(ctx context.Context, args Args) error {
+
+	specs, err := LoadRequestSpecs(args.Requests)
+	if err != nil {
+		return err
+	}
+
+	if !args.Template {
+		for _, spec := range specs {
+			if len(spec.Capture) > 0 {
+				return errors.New(spec.Name + ": capture needs template to use the captured variables")
+			}
+		}
+	}
+
+	vars := map[string]interface{}{}
+
+	for i := range specs {
+		spec := &specs[i]
+
+		plugin := GetNewPlugin(spec.ToArgs(args))
+		plugin.templateData = vars
+
+		_ = plugin.Init()
+
+		LogPrintf(plugin, "%s (%d of %d)\n", spec.Name, i+1, len(specs))
+
+		err := plugin.Run()
+		if err == nil {
+			err = plugin.CaptureVariables(spec.Capture, vars)
+		}
+
+		deInitErr := plugin.DeInit()
+
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", spec.Name, err)
+		}
+		if deInitErr != nil {
+			return deInitErr
+		}
+	}
+
+	return nil
+}
+
+// CaptureVariables stores the values selected by capture into vars.
+func (p *Plugin) CaptureVariables(capture map[string]string, vars map[string]interface{}) error {
+
+	for name, expr := range capture {
+		value, err := p.CaptureValue(expr)
+		if err != nil {
+			return fmt.Errorf("capture %s: %v", name, err)
+		}
+		vars[name] = value
+		LogPrintf(p, "captured %s\n", name)
+	}
+
+	return nil
+}
+
+func (p *Plugin) CaptureValue(expr string) (string, error) {
+
+	expr = strings.TrimSpace(expr)
+
+	switch {
+	case strings.HasPrefix(expr, "$"):
+		path, err := ParseJsonPath(expr)
+		if err != nil {
+			return "", err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(p.httpResponseBodyBytes, &doc); err != nil {
+			return "", errors.New("response body is not valid json")
+		}
+		values := path.Evaluate(doc)
+		if len(values) == 0 {
+			return "", errors.New("json path " + expr + " not found")
+		}
+		return plainString(values[0]), nil
+
+	case strings.HasPrefix(expr, "header:"):
+		name := strings.TrimSpace(strings.TrimPrefix(expr, "header:"))
+		if p.httpResponse == nil || p.httpResponse.Header.Get(name) == "" {
+			return "", errors.New("header " + name + " not found")
+		}
+		return p.httpResponse.Header.Get(name), nil
+
+	case strings.HasPrefix(expr, "regex:"):
+		re, err := regexp.Compile(strings.TrimPrefix(expr, "regex:"))
+		if err != nil {
+			return "", err
+		}
+		match := re.FindStringSubmatch(p.ResponseContent)
+		if match == nil {
+			return "", errors.New("regex " + re.String() + " did not match")
+		}
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	}
+
+	return "", errors.New("unknown capture expression " + expr + ", expected $.path, header:Name or regex:pattern")
+}
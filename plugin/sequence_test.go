@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newSequenceTestServer(t *testing.T, uploads *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/login":
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != `{"user":"drone"}` {
+				http.Error(w, "bad login", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"auth":{"token":"t0k3n"}}`))
+
+		case r.Header.Get("Authorization") != "Bearer t0k3n":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		case r.Method == "POST" && r.URL.Path == "/releases":
+			w.Header().Set("X-Release-Id", "42")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":42,"upload_url":"/releases/42/assets"}`))
+
+		case r.Method == "PUT" && r.URL.Path == "/releases/42/assets":
+			body, _ := io.ReadAll(r.Body)
+			*uploads = append(*uploads, r.URL.Query().Get("name")+"="+string(body))
+			w.WriteHeader(http.StatusCreated)
+
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRequestSequenceWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestRequestSequenceWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestRequestSequenceWithLocalServer test")
+	}
+
+	var uploads []string
+	ts := newSequenceTestServer(t, &uploads)
+	defer ts.Close()
+
+	requests := `[
+		{"name": "login", "url": "` + ts.URL + `/login", "method": "POST", "body": "{\"user\":\"drone\"}",
+		 "capture": {"token": "$.auth.token"}},
+		{"name": "create release", "url": "` + ts.URL + `/releases", "method": "POST", "body": "{}",
+		 "headers": "Authorization: Bearer {{ .token }}", "valid_response_codes": "201",
+		 "capture": {"release_id": "header:X-Release-Id", "upload_path": "regex:\"upload_url\":\"([^\"]+)\""}},
+		{"name": "upload asset", "url": "` + ts.URL + `{{ .upload_path }}?name=app-{{ .release_id }}.txt", "method": "PUT",
+		 "body": "asset for {{ .release_id }}", "headers": "Authorization: Bearer {{ .token }}"}
+	]`
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Requests: requests,
+			Headers:  "X-Pipeline: drone",
+			Quiet:    true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err == nil || !strings.Contains(err.Error(), "login: capture needs template") {
+		t.Fatalf("Expected capture without template to fail, got: %v", err)
+	}
+
+	args.Template = true
+	err = Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	if len(uploads) != 1 || uploads[0] != "app-42.txt=asset for 42" {
+		t.Errorf("Expected one upload of app-42.txt, got %v", uploads)
+	}
+}
+
+func TestRequestSequenceFromYamlFile(t *testing.T) {
+
+	_, found := enableTests["TestRequestSequenceFromYamlFile"]
+	if !found {
+		t.Skip("Skipping TestRequestSequenceFromYamlFile test")
+	}
+
+	var uploads []string
+	ts := newSequenceTestServer(t, &uploads)
+	defer ts.Close()
+
+	requestsFile := filepath.Join(t.TempDir(), "requests.yml")
+	requests := `
+- name: login
+  url: ` + ts.URL + `/login
+  method: POST
+  body: '{"user":"drone"}'
+  capture:
+    token: $.auth.token
+- name: create release
+  url: ` + ts.URL + `/releases
+  method: POST
+  headers: "Authorization: Bearer {{ .token }}"
+  capture:
+    release_id: $.id
+- name: bad capture
+  url: ` + ts.URL + `/releases/{{ .release_id }}/assets
+  method: PUT
+  headers: "Authorization: Bearer {{ .token }}"
+  capture:
+    missing: header:X-Missing
+`
+	if err := os.WriteFile(requestsFile, []byte(requests), 0644); err != nil {
+		t.Fatalf("Failed to write requests file: %v", err)
+	}
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Requests: requestsFile,
+			Template: true,
+			Quiet:    true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err == nil {
+		t.Fatalf("Expected the missing capture to fail the sequence")
+	}
+	if !strings.Contains(err.Error(), "bad capture failed: capture missing: header X-Missing not found") {
+		t.Errorf("Expected the failing request and capture in the error, got: %v", err)
+	}
+	if len(uploads) != 1 {
+		t.Errorf("Expected the upload to run before the capture failed, got %v", uploads)
+	}
+
+	args.Requests = `[{"name": "no variable", "url": "` + ts.URL + `/{{ .undefined }}"}]`
+	if err := Exec(context.Background(), args); err == nil || !strings.Contains(err.Error(), "undefined") {
+		t.Errorf("Expected an undefined variable to fail, got: %v", err)
+	}
+}
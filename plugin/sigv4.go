@@ -0,0 +1,256 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAwsService  = "execute-api"
+	AwsSigv4Algorithm  = "AWS4-HMAC-SHA256"
+	AwsAmzDateFormat   = "20060102T150405Z"
+	AwsShortDateFormat = "20060102"
+)
+
+type AwsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// ValidateAwsSigv4 reads the region and the credentials for
+// auth_aws_sigv4. The region falls back to AWS_REGION and
+// AWS_DEFAULT_REGION, the credentials come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func (p *Plugin) ValidateAwsSigv4() error {
+
+	p.awsCredentials = nil
+
+	if !p.AuthAwsSigv4 {
+		return nil
+	}
+
+	if p.IsAuthBasic() || p.AuthBearer != "" || p.AuthBearerFile != "" || p.IsOAuth2() {
+		return errors.New("auth_aws_sigv4 cannot be combined with auth_basic, auth_bearer or oauth2")
+	}
+
+	if p.AwsRegion == "" {
+		p.AwsRegion = os.Getenv("AWS_REGION")
+	}
+	if p.AwsRegion == "" {
+		p.AwsRegion = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if p.AwsRegion == "" {
+		return errors.New("aws_region is required with auth_aws_sigv4")
+	}
+
+	if p.AwsService == "" {
+		p.AwsService = DefaultAwsService
+	}
+
+	credentials := &AwsCredentials{
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyId == "" || credentials.SecretAccessKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required with auth_aws_sigv4")
+	}
+
+	p.awsCredentials = credentials
+	return nil
+}
+
+// SetAwsSigv4 signs the request as it is about to be sent, so it runs
+// after every header has been set.
+func (p *Plugin) SetAwsSigv4() error {
+
+	if p.awsCredentials == nil {
+		return nil
+	}
+
+	if p.HttpReq == nil {
+		return errors.New("SetAwsSigv4 http request is nil")
+	}
+
+	payloadHash := sha256.New()
+	err := p.HashRequestBody(payloadHash)
+	if err != nil {
+		return err
+	}
+
+	SignAwsSigv4(p.HttpReq, p.awsCredentials, p.AwsRegion, p.AwsService,
+		hex.EncodeToString(payloadHash.Sum(nil)), time.Now())
+
+	return nil
+}
+
+// SignAwsSigv4 adds the X-Amz-Date, X-Amz-Security-Token and
+// Authorization headers of an AWS Signature Version 4 to req. The host,
+// content length and type and every x-amz-* header are signed. The path
+// is sent strictly encoded, go leaves characters such as + : = @
+// unescaped, so that the server sees the path that was signed.
+func SignAwsSigv4(req *http.Request, credentials *AwsCredentials, region, service, payloadHash string, now time.Time) {
+
+	if req.URL.Path != "" {
+		req.URL.RawPath = awsUriEncode(req.URL.Path, false)
+	}
+
+	now = now.UTC()
+	amzDate := now.Format(AwsAmzDateFormat)
+	shortDate := now.Format(AwsShortDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	if req.ContentLength > 0 {
+		headers["content-length"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, value := range values {
+				trimmed[i] = strings.Join(strings.Fields(value), " ")
+			}
+			headers[name] = strings.Join(trimmed, ",")
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsCanonicalUri(req, service),
+		awsCanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := shortDate + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		AwsSigv4Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{shortDate, region, service, "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set(AuthorizationHeader, AwsSigv4Algorithm+
+		" Credential="+credentials.AccessKeyId+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+// awsCanonicalUri is the path as it is sent for s3, every other service
+// expects it to be encoded once more.
+func awsCanonicalUri(req *http.Request, service string) string {
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		return "/"
+	}
+
+	if service != "s3" {
+		uri = awsUriEncode(uri, false)
+	}
+
+	return uri
+}
+
+func awsCanonicalQuery(req *http.Request) string {
+
+	var pairs [][2]string
+
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{awsUriEncode(name, true), awsUriEncode(value, true)})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, pair := range pairs {
+		encoded[i] = pair[0] + "=" + pair[1]
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// awsUriEncode percent encodes everything but the unreserved
+// characters, and the slash unless encodeSlash is set.
+func awsUriEncode(value string, encodeSlash bool) string {
+
+	const hexDigits = "0123456789ABCDEF"
+
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			out.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			out.WriteByte(c)
+		default:
+			out.WriteByte('%')
+			out.WriteByte(hexDigits[c>>4])
+			out.WriteByte(hexDigits[c&15])
+		}
+	}
+
+	return out.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAwsSigv4Signature(t *testing.T) {
+
+	_, found := enableTests["TestAwsSigv4Signature"]
+	if !found {
+		t.Skip("Skipping TestAwsSigv4Signature test")
+	}
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	credentials := &AwsCredentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	tests := []struct {
+		method, url, body, contentType, service, sessionToken string
+		signedHeaders, signature                              string
+	}{
+		{"GET", "https://example.amazonaws.com/", "", "", "service", "",
+			"host;x-amz-date", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"GET", "https://example.amazonaws.com/a b/c$d?Param2=value2&Param1=value%201&Param1=a", "", "", "execute-api", "",
+			"host;x-amz-date", "6424598806e78701110d48c579bd6be6a060f107a9bd44848dadf41d5195a599"},
+		{"POST", "https://example.amazonaws.com/prod/items", `{"a":1}`, "application/json", "execute-api", "sess",
+			"content-length;content-type;host;x-amz-date;x-amz-security-token", "a8e6ae98b8b5b571c7ece773f3555720140edb426c24bb1a8b8b7f7273cf913a"},
+		{"PUT", "http://minio.local:9000/bucket/dir/file name.txt", "data", "application/octet-stream", "s3", "",
+			"content-length;content-type;host;x-amz-content-sha256;x-amz-date", "7d3273bb21ae08be3d083c66ba508b6f1652176314dc21bc9320f43649f03d7e"},
+		{"PUT", "http://minio.local:9000/bucket/reports/a+b=c:d e.txt", "data", "application/octet-stream", "s3", "",
+			"content-length;content-type;host;x-amz-content-sha256;x-amz-date", "4a0f29f89585baabf90e8bf88f0bfd8ac53c673995fd9d916138986e317976f4"},
+		{"GET", "https://example.amazonaws.com/prod/items/a+b=c:d e", "", "", "execute-api", "",
+			"host;x-amz-date", "5116ad2a794799c5e732a20adac0e25160de874530c676505ec373e1ec0d6931"},
+		{"POST", "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/arn:aws:lambda:us-east-1:123456789012:function:deploy/invocations", "{}", "application/json", "lambda", "",
+			"content-length;content-type;host;x-amz-date", "8e3e7395277baefe1b9be9c825774da387777846f211fd0a87bb008e8e813470"},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set(ContentType, tc.contentType)
+		}
+		payloadHash := sha256.Sum256([]byte(tc.body))
+		credentials.SessionToken = tc.sessionToken
+
+		SignAwsSigv4(req, credentials, "us-east-1", tc.service, hex.EncodeToString(payloadHash[:]), now)
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/" + tc.service + "/aws4_request, " +
+			"SignedHeaders=" + tc.signedHeaders + ", Signature=" + tc.signature
+		if got := req.Header.Get("Authorization"); got != expected {
+			t.Errorf("%s %s:\nexpected %s\ngot      %s", tc.method, tc.url, expected, got)
+		}
+	}
+}
+
+func TestAwsCanonicalUri(t *testing.T) {
+
+	_, found := enableTests["TestAwsCanonicalUri"]
+	if !found {
+		t.Skip("Skipping TestAwsCanonicalUri test")
+	}
+
+	credentials := &AwsCredentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+
+	// wire is the path as it is sent, canonical the path the server
+	// signs, the wire path for s3 and the wire path escaped once more
+	// otherwise, like the SDKs do with EscapePath(EscapedPath())
+	tests := []struct {
+		url, service    string
+		sign            bool
+		wire, canonical string
+	}{
+		{"https://example.com", "s3", true, "", "/"},
+		{"https://example.com/bucket/a+b=c:d e.txt", "s3", true,
+			"/bucket/a%2Bb%3Dc%3Ad%20e.txt", "/bucket/a%2Bb%3Dc%3Ad%20e.txt"},
+		{"https://example.com/bucket/a%2Bb%3Dc.txt", "s3", true,
+			"/bucket/a%2Bb%3Dc.txt", "/bucket/a%2Bb%3Dc.txt"},
+		{"https://example.com/bucket/it's(1)!*,;@$&.txt", "s3", true,
+			"/bucket/it%27s%281%29%21%2A%2C%3B%40%24%26.txt", "/bucket/it%27s%281%29%21%2A%2C%3B%40%24%26.txt"},
+		{"https://example.com/prod/a+b=c:d e", "execute-api", true,
+			"/prod/a%2Bb%3Dc%3Ad%20e", "/prod/a%252Bb%253Dc%253Ad%2520e"},
+		{"https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/arn:aws:lambda:us-east-1:123456789012:function:deploy/invocations", "lambda", true,
+			"/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-east-1%3A123456789012%3Afunction%3Adeploy/invocations",
+			"/2015-03-31/functions/arn%253Aaws%253Alambda%253Aus-east-1%253A123456789012%253Afunction%253Adeploy/invocations"},
+		{"https://example.com/prod/a+b=c:d e", "execute-api", false,
+			"/prod/a+b=c:d%20e", "/prod/a%2Bb%3Dc%3Ad%2520e"},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		if tc.sign {
+			SignAwsSigv4(req, credentials, "us-east-1", tc.service, "", time.Now())
+		}
+		if got := req.URL.EscapedPath(); got != tc.wire {
+			t.Errorf("%s for %s: expected %s on the wire, got %s", tc.url, tc.service, tc.wire, got)
+		}
+		if got := awsCanonicalUri(req, tc.service); got != tc.canonical {
+			t.Errorf("%s for %s: expected canonical uri %s, got %s", tc.url, tc.service, tc.canonical, got)
+		}
+	}
+}
+
+func TestAwsSigv4WithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestAwsSigv4WithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestAwsSigv4WithLocalServer test")
+	}
+
+	var received []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodyHash := sha256.Sum256(body)
+
+		authorization := r.Header.Get("Authorization")
+		received = append(received, authorization)
+
+		if !strings.Contains(authorization, "Credential=AKIDLOCAL/") || !strings.Contains(authorization, "/eu-west-1/s3/aws4_request") ||
+			r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(bodyHash[:]) || r.Header.Get("X-Amz-Security-Token") != "s3ss10n" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDLOCAL",
+		"AWS_SECRET_ACCESS_KEY": "l0cal-s3cr3t",
+		"AWS_SESSION_TOKEN":     "s3ss10n",
+		"AWS_REGION":            "eu-west-1",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	uploadFile := filepath.Join(t.TempDir(), "artifact.bin")
+	if err := os.WriteFile(uploadFile, []byte("artifact contents"), 0644); err != nil {
+		t.Fatalf("Failed to write upload file: %v", err)
+	}
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:          ts.URL + "/bucket/artifact.bin",
+			HttpMethod:   "PUT",
+			UploadFile:   uploadFile,
+			AuthAwsSigv4: true,
+			AwsService:   "s3",
+			Quiet:        true,
+		},
+	}
+
+	err := Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	args.UploadFile = ""
+	args.HttpMethod = "POST"
+	args.RequestBody = `{"key":"value"}`
+
+	err = Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() with a request body returned an error: %v", err)
+	}
+
+	if len(received) != 2 || received[0] == received[1] {
+		t.Errorf("Expected two distinct signatures, got %v", received)
+	}
+
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	if err := Exec(context.Background(), args); err == nil {
+		t.Errorf("Expected missing credentials to be rejected")
+	}
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// socks5TestServer is a minimal SOCKS5 server that connects every
+// CONNECT request to target and records the requested addresses.
+type socks5TestServer struct {
+	listener net.Listener
+	target   string
+	user     string
+	pass     string
+
+	mu        sync.Mutex
+	requested []string
+}
+
+func newSocks5TestServer(t *testing.T, target, user, pass string) *socks5TestServer {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &socks5TestServer{listener: listener, target: target, user: user, pass: pass}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *socks5TestServer) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 5 {
+		return
+	}
+	methods := make([]byte, header[1])
+	io.ReadFull(conn, methods)
+
+	if s.user == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		if !strings.Contains(string(methods), "\x02") {
+			conn.Write([]byte{5, 0xff})
+			return
+		}
+		conn.Write([]byte{5, 2})
+
+		version := make([]byte, 2)
+		io.ReadFull(conn, version)
+		user := make([]byte, version[1])
+		io.ReadFull(conn, user)
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		pass := make([]byte, length[0])
+		io.ReadFull(conn, pass)
+
+		if string(user) != s.user || string(pass) != s.pass {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil || request[1] != 1 {
+		return
+	}
+
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	case 4:
+		ip := make([]byte, 16)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+
+	s.mu.Lock()
+	s.requested = append(s.requested, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", s.target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (s *socks5TestServer) Requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requested...)
+}
+
+func TestSocks5ProxyWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestSocks5ProxyWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestSocks5ProxyWithLocalServer test")
+	}
+
+	var hosts []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+	}))
+	defer ts.Close()
+
+	socks := newSocks5TestServer(t, ts.Listener.Addr().String(), "tunnel", "s0cks-pass")
+	defer socks.listener.Close()
+
+	socksAddress := socks.listener.Addr().String()
+
+	run := func(target string, params PluginInputParams) error {
+		params.Url = "http://" + target + "/status"
+		params.HttpMethod = "GET"
+		params.Timeout = 5
+		params.Quiet = true
+		return Exec(context.Background(), Args{PluginInputParams: params})
+	}
+
+	// socks5h leaves the name to the proxy, which resolves it
+	remote := PluginInputParams{Proxy: "socks5h://tunnel:s0cks-pass@" + socksAddress}
+	if err := run("prod-api.internal.invalid:8080", remote); err != nil {
+		t.Fatalf("Exec() through socks5h returned an error: %v", err)
+	}
+
+	// socks5 resolves the name locally and sends the address
+	local := PluginInputParams{Proxy: "socks5://" + socksAddress, ProxyUser: "tunnel", ProxyPassword: "s0cks-pass"}
+	if err := run("localhost:8080", local); err != nil {
+		t.Fatalf("Exec() through socks5 returned an error: %v", err)
+	}
+
+	requested := socks.Requested()
+	if len(requested) != 2 || requested[0] != "prod-api.internal.invalid:8080" {
+		t.Fatalf("Expected the proxy to resolve the socks5h name, got %v", requested)
+	}
+	if host, _, _ := net.SplitHostPort(requested[1]); net.ParseIP(host) == nil {
+		t.Errorf("Expected socks5 to send an address, got %s", requested[1])
+	}
+	if len(hosts) != 2 || hosts[0] != "prod-api.internal.invalid:8080" {
+		t.Errorf("Expected the requests to keep their host, got %v", hosts)
+	}
+
+	bypass := local
+	bypass.NoProxy = ".internal.invalid"
+	if err := run("prod-api.internal.invalid:8080", bypass); err == nil {
+		t.Errorf("Expected the bypassed host to fail to resolve")
+	}
+	if len(socks.Requested()) != 2 {
+		t.Errorf("Expected no_proxy to bypass the socks proxy, got %v", socks.Requested())
+	}
+
+	wrongPassword := PluginInputParams{Proxy: "socks5h://tunnel:wrong@" + socksAddress}
+	if err := run("prod-api.internal.invalid:8080", wrongPassword); err == nil {
+		t.Errorf("Expected the socks proxy to refuse the wrong password")
+	}
+
+	if err := run("prod-api.internal.invalid:8080", PluginInputParams{Proxy: "ftp://" + socksAddress}); err == nil {
+		t.Errorf("Expected an unsupported proxy scheme to be rejected")
+	}
+}
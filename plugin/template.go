@@ -0,0 +1,217 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+/*
+	With template set, the url, headers and request body and the jwt
+	settings are rendered as go templates before the request is
+	validated, without it text such as {{ }} of a Handlebars or GraphQL
+	payload is sent as is. The upload file contents are rendered when
+	template_upload is set. The data holds the
+	pipeline metadata under the names of the Pipeline fields,
+	{{ .Build.Number }}, {{ .Commit.Rev }}, {{ .Repo.Slug }},
+	{{ .Semver.Version }}, {{ .Tag.Name }} and so on, and the variables
+	captured by earlier requests of a sequence, such as {{ .token }}.
+
+	jwt_claims is parsed as a json object first and only its string
+	values are rendered, the claims are encoded as json afterwards so
+	rendered values are escaped.
+
+	json       {{ json .Failed.Steps }}         value as json
+	urlquery   {{ urlquery .Commit.Branch }}    query escaped string
+	default    {{ default "latest" .Tag.Name }} fallback for empty values
+	env        {{ env "DEPLOY_ENV" }}           environment variable
+	trunc      {{ trunc 7 .Commit.Rev }}        first n characters
+	upper, lower, trim
+*/
+
+var templateFuncs = template.FuncMap{
+	"json":     templateJson,
+	"urlquery": templateUrlQuery,
+	"default":  templateDefault,
+	"env":      os.Getenv,
+	"trunc":    templateTrunc,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+}
+
+// RenderTemplates renders the url, headers, request body and jwt
+// settings when template is set.
+func (p *Plugin) RenderTemplates() error {
+
+	if !p.Template {
+		return nil
+	}
+
+	data := p.GetTemplateData()
+
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"url", &p.Url},
+		{"headers", &p.Headers},
+		{"request_body", &p.RequestBody},
+		{"jwt_issuer", &p.JwtIssuer},
+		{"jwt_audience", &p.JwtAudience},
+		{"jwt_subject", &p.JwtSubject},
+	}
+
+	for _, field := range fields {
+		rendered, err := renderTemplate(field.name, *field.value, data)
+		if err != nil {
+			return err
+		}
+		*field.value = rendered
+	}
+
+	if p.JwtClaims != "" && strings.Contains(p.JwtClaims, "{{") {
+		var claims map[string]interface{}
+		if err := json.Unmarshal([]byte(p.JwtClaims), &claims); err != nil {
+			return errors.New("jwt_claims is not a json object: " + err.Error())
+		}
+		if _, err := renderJsonStrings("jwt_claims", claims, data); err != nil {
+			return err
+		}
+		rendered, err := json.Marshal(claims)
+		if err != nil {
+			return err
+		}
+		p.JwtClaims = string(rendered)
+	}
+
+	return nil
+}
+
+// RenderUploadFile returns the upload file contents rendered as a
+// template, it is used instead of the file when template_upload is set.
+func (p *Plugin) RenderUploadFile() (*strings.Reader, error) {
+
+	content, err := os.ReadFile(p.uploadFileAbsolutePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+
+	rendered, err := renderTemplate("upload_file", string(content), p.GetTemplateData())
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(rendered), nil
+}
+
+// GetTemplateData returns the pipeline metadata merged with the
+// captured variables, captured variables cannot shadow metadata.
+func (p *Plugin) GetTemplateData() map[string]interface{} {
+
+	data := map[string]interface{}{}
+
+	for name, value := range p.templateData {
+		data[name] = value
+	}
+
+	v := reflect.ValueOf(p.Pipeline)
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		data[t.Field(i).Name] = v.Field(i).Interface()
+	}
+
+	return data
+}
+
+func renderTemplate(name, text string, data interface{}) (string, error) {
+
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %v", name, err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", name, err)
+	}
+
+	return out.String(), nil
+}
+
+// renderJsonStrings renders the string values of a decoded json value,
+// maps and slices are rendered in place.
+func renderJsonStrings(name string, value interface{}, data interface{}) (interface{}, error) {
+
+	var err error
+
+	switch v := value.(type) {
+	case string:
+		return renderTemplate(name, v, data)
+	case map[string]interface{}:
+		for key, item := range v {
+			if v[key], err = renderJsonStrings(name, item, data); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = renderJsonStrings(name, item, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return value, nil
+}
+
+func templateJson(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func templateUrlQuery(value interface{}) string {
+	return url.QueryEscape(fmt.Sprint(value))
+}
+
+func templateDefault(fallback interface{}, value interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return fallback
+		}
+	default:
+		if v.IsZero() {
+			return fallback
+		}
+	}
+	return value
+}
+
+func templateTrunc(length int, value string) string {
+	runes := []rune(value)
+	if length < 0 || length >= len(runes) {
+		return value
+	}
+	return string(runes[:length])
+}
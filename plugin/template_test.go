@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTemplateTestServer(t *testing.T, received *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*received = append(*received, r.URL.RequestURI(), r.Header.Get("X-Build"), string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestTemplatesWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestTemplatesWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestTemplatesWithLocalServer test")
+	}
+
+	var received []string
+	ts := newTemplateTestServer(t, &received)
+	defer ts.Close()
+
+	defer os.Setenv("DEPLOY_ENV", os.Getenv("DEPLOY_ENV"))
+	os.Setenv("DEPLOY_ENV", "staging")
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:         ts.URL + "/deploy?branch={{ urlquery .Commit.Branch }}",
+			HttpMethod:  "POST",
+			Headers:     "X-Build: {{ .Build.Number }}",
+			RequestBody: `{"rev":"{{ trunc 7 .Commit.Rev }}","tag":"{{ default "latest" .Tag.Name }}","env":"{{ env "DEPLOY_ENV" }}","failed":{{ json .Failed.Steps }}}`,
+			Template:    true,
+			Quiet:       true,
+		},
+	}
+	args.Build.Number = 17
+	args.Commit.Branch = "feature/a b"
+	args.Commit.Rev = "0123456789abcdef"
+	args.Failed.Steps = []string{"test"}
+
+	err := Exec(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	expected := []string{
+		"/deploy?branch=feature%2Fa+b",
+		"17",
+		`{"rev":"0123456","tag":"latest","env":"staging","failed":["test"]}`,
+	}
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected rendered request %q, got %q", expected, received)
+	}
+
+	args.RequestBody = "{{ .Build.Unknown }}"
+	if err := Exec(context.Background(), args); err == nil || !strings.Contains(err.Error(), "request_body") {
+		t.Errorf("Expected an unknown field to fail rendering, got: %v", err)
+	}
+
+	args.Template = false
+	args.Url = ts.URL + "/graphql"
+	args.Headers = ""
+	args.RequestBody = `{"query":"{{ user }}","partial":"{{> header }}"}`
+	if err := Exec(context.Background(), args); err != nil {
+		t.Fatalf("Exec() without template returned an error: %v", err)
+	}
+	if received[len(received)-1] != args.RequestBody {
+		t.Errorf("Expected the body as is without template, got %q", received[len(received)-1])
+	}
+}
+
+func TestTemplateUploadWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestTemplateUploadWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestTemplateUploadWithLocalServer test")
+	}
+
+	var received []string
+	ts := newTemplateTestServer(t, &received)
+	defer ts.Close()
+
+	uploadFile := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(uploadFile, []byte(`{"build":{{ .Build.Number }}}`), 0644); err != nil {
+		t.Fatalf("Failed to write upload file: %v", err)
+	}
+
+	args := Args{
+		PluginInputParams: PluginInputParams{
+			Url:        ts.URL + "/upload",
+			HttpMethod: "PUT",
+			UploadFile: uploadFile,
+			Quiet:      true,
+		},
+	}
+	args.Build.Number = 5
+
+	if err := Exec(context.Background(), args); err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+	if received[2] != `{"build":{{ .Build.Number }}}` {
+		t.Errorf("Expected the upload file as is without template_upload, got %q", received[2])
+	}
+
+	args.TemplateUpload = true
+	if err := Exec(context.Background(), args); err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+	if received[5] != `{"build":5}` {
+		t.Errorf("Expected the rendered upload file, got %q", received[5])
+	}
+
+	args.WrapAsMultipart = true
+	args.MultiPartName = "payload"
+	if err := Exec(context.Background(), args); err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+	if !strings.Contains(received[8], `{"build":5}`) {
+		t.Errorf("Expected the rendered upload file in the multipart body, got %q", received[8])
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	timeout bounds the whole request, body download included. The other
+	timeouts fail a request early at one of its steps, so that a large
+	download can get a long timeout and still fail fast when the server
+	is unreachable:
+
+	connect_timeout            dialing the server or the proxy, 30s by default
+	tls_handshake_timeout      the tls handshake, 10s by default
+	response_header_timeout    waiting for the headers once the request is sent
+	read_idle_timeout          waiting for the next chunk of the response body
+
+	All of them take seconds or a duration like 500ms or 2m.
+*/
+
+// ValidateTimeouts parses the timeouts of the steps of a request.
+func (p *Plugin) ValidateTimeouts() error {
+
+	settings := []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"connect_timeout", p.ConnectTimeout, &p.connectTimeout},
+		{"tls_handshake_timeout", p.TlsHandshakeTimeout, &p.tlsHandshakeTimeout},
+		{"response_header_timeout", p.ResponseHeaderTimeout, &p.responseHeaderTimeout},
+		{"read_idle_timeout", p.ReadIdleTimeout, &p.readIdleTimeout},
+	}
+
+	for _, setting := range settings {
+		*setting.target = 0
+		if setting.value == "" {
+			continue
+		}
+
+		duration, err := ParseDurationSetting(setting.value)
+		if err != nil {
+			return errors.New("invalid " + setting.name + ": " + err.Error())
+		}
+		if duration == 0 {
+			return errors.New("invalid " + setting.name + ", it must be greater than zero")
+		}
+		*setting.target = duration
+	}
+
+	return nil
+}
+
+// SetTransportTimeouts bounds the tls handshake and the wait for the
+// response headers.
+func (p *Plugin) SetTransportTimeouts(transport *http.Transport) error {
+
+	if p.tlsHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = p.tlsHandshakeTimeout
+	}
+	if p.responseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = p.responseHeaderTimeout
+	}
+
+	return nil
+}
+
+// SetReadIdleTimeout cancels the request when its response body stalls
+// for longer than read_idle_timeout.
+func (p *Plugin) SetReadIdleTimeout(resp *http.Response) {
+
+	if p.readIdleTimeout == 0 || p.HttpRequestCancelContext == nil {
+		return
+	}
+
+	cancel := p.HttpRequestCancelContext
+	body := &idleTimeoutBody{ReadCloser: resp.Body, timeout: p.readIdleTimeout}
+	body.timer = time.AfterFunc(p.readIdleTimeout, func() {
+		atomic.StoreInt32(&body.expired, 1)
+		cancel()
+	})
+	resp.Body = body
+}
+
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func (b *idleTimeoutBody) Read(data []byte) (int, error) {
+
+	n, err := b.ReadCloser.Read(data)
+
+	if atomic.LoadInt32(&b.expired) == 1 {
+		return n, errors.New("response body stalled for longer than read_idle_timeout " + b.timeout.String())
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDurationSecondsDecode(t *testing.T) {
+
+	_, found := enableTests["TestDurationSecondsDecode"]
+	if !found {
+		t.Skip("Skipping TestDurationSecondsDecode test")
+	}
+
+	cases := map[string]time.Duration{
+		"30":    30 * time.Second,
+		"1.5":   1500 * time.Millisecond,
+		"500ms": 500 * time.Millisecond,
+		"2m":    2 * time.Minute,
+	}
+
+	for value, expected := range cases {
+		var d DurationSeconds
+		if err := d.Decode(value); err != nil {
+			t.Fatalf("Decode(%q) returned an error: %v", value, err)
+		}
+		if d.Duration() != expected {
+			t.Errorf("Decode(%q) = %s, expected %s", value, d.Duration(), expected)
+		}
+	}
+
+	for _, value := range []string{"soon", "-5", "-1s"} {
+		var d DurationSeconds
+		if err := d.Decode(value); err == nil {
+			t.Errorf("Expected Decode(%q) to fail", value)
+		}
+	}
+}
+
+func TestTimeoutsWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestTimeoutsWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestTimeoutsWithLocalServer test")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stall := func(d time.Duration) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(d):
+			}
+		}
+
+		switch r.URL.Path {
+		case "/slow-headers":
+			stall(3 * time.Second)
+		case "/stalled-body":
+			w.Write([]byte("first chunk"))
+			w.(http.Flusher).Flush()
+			stall(3 * time.Second)
+		case "/steady-body":
+			for i := 0; i < 5; i++ {
+				w.Write([]byte("chunk"))
+				w.(http.Flusher).Flush()
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	run := func(path string, params PluginInputParams) (time.Duration, error) {
+		params.Url = ts.URL + path
+		params.HttpMethod = "GET"
+		params.Timeout = 10
+		params.Quiet = true
+		start := time.Now()
+		err := Exec(context.Background(), Args{PluginInputParams: params})
+		return time.Since(start), err
+	}
+
+	elapsed, err := run("/slow-headers", PluginInputParams{ResponseHeaderTimeout: "200ms"})
+	if err == nil || elapsed > 2*time.Second {
+		t.Errorf("Expected response_header_timeout to fail the request early, took %s, err %v", elapsed, err)
+	}
+
+	elapsed, err = run("/stalled-body", PluginInputParams{ReadIdleTimeout: "0.2"})
+	if err == nil || elapsed > 2*time.Second {
+		t.Errorf("Expected read_idle_timeout to fail the request early, took %s, err %v", elapsed, err)
+	}
+
+	_, err = run("/steady-body", PluginInputParams{ReadIdleTimeout: "300ms"})
+	if err != nil {
+		t.Errorf("Expected a steady body within read_idle_timeout to succeed: %v", err)
+	}
+
+	plugin := &Plugin{}
+	plugin.TlsHandshakeTimeout = "2s"
+	plugin.ConnectTimeout = "1s"
+	if err := plugin.ValidateTimeouts(); err != nil {
+		t.Fatal(err)
+	}
+	transport, err := plugin.NewHttpTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.TLSHandshakeTimeout != 2*time.Second || transport.ResponseHeaderTimeout != 0 {
+		t.Errorf("Unexpected transport timeouts %s, %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	for _, params := range []PluginInputParams{{ConnectTimeout: "soon"}, {ReadIdleTimeout: "0s"}} {
+		if _, err := run("/steady-body", params); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
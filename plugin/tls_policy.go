@@ -0,0 +1,178 @@
+// Copyright 2020 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+/*
+	tls_min_version and tls_max_version take 1.0 to 1.3. tls_ciphers
+	lists the cipher suites by their IANA name, they only apply up to
+	TLS 1.2 as 1.3 suites are not configurable. tls_server_name is sent
+	as SNI and verified against the certificate instead of the url host.
+
+	tls_pin_sha256 lists base64 SHA-256 hashes of the public key (SPKI)
+	of the certificates, the connection is accepted when any certificate
+	of the verified chain matches any pin, as with
+
+	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+
+	Pins are checked even with ignore_ssl, which pins a self-signed
+	certificate without trusting anything else. As there is no verified
+	chain then, only the leaf certificate is matched, the server proves
+	it holds that key but not the other certificates it sends.
+*/
+
+type TlsPolicy struct {
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+	ServerName   string
+	Pins         [][]byte
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ValidateTlsPolicy parses the tls version range, cipher suites, server
+// name and pins.
+func (p *Plugin) ValidateTlsPolicy() error {
+
+	p.tlsPolicy = nil
+
+	if p.TlsMinVersion == "" && p.TlsMaxVersion == "" && p.TlsCiphers == "" && p.TlsServerName == "" && p.TlsPinSha256 == "" {
+		return nil
+	}
+
+	policy := &TlsPolicy{ServerName: strings.TrimSpace(p.TlsServerName)}
+
+	var err error
+	if policy.MinVersion, err = parseTlsVersion("tls_min_version", p.TlsMinVersion); err != nil {
+		return err
+	}
+	if policy.MaxVersion, err = parseTlsVersion("tls_max_version", p.TlsMaxVersion); err != nil {
+		return err
+	}
+	if policy.MinVersion != 0 && policy.MaxVersion != 0 && policy.MinVersion > policy.MaxVersion {
+		return errors.New("tls_min_version " + p.TlsMinVersion + " is above tls_max_version " + p.TlsMaxVersion)
+	}
+
+	if ciphers := SplitSettingList(p.TlsCiphers); len(ciphers) > 0 {
+		if policy.MinVersion == tls.VersionTLS13 {
+			return errors.New("tls_ciphers do not apply to TLS 1.3, the tls_min_version")
+		}
+
+		suites := map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, suite := range tls.InsecureCipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+
+		for _, cipher := range ciphers {
+			id, ok := suites[strings.ToUpper(cipher)]
+			if !ok {
+				return errors.New("unknown cipher suite " + cipher + " in tls_ciphers")
+			}
+			policy.CipherSuites = append(policy.CipherSuites, id)
+		}
+	}
+
+	for _, pin := range SplitSettingList(p.TlsPinSha256) {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256//"))
+		if err != nil || len(hash) != sha256.Size {
+			return errors.New("invalid tls_pin_sha256 " + pin + ", expected the base64 SHA-256 of a public key")
+		}
+		policy.Pins = append(policy.Pins, hash)
+	}
+
+	p.tlsPolicy = policy
+	return nil
+}
+
+// SetTransportTlsPolicy applies the tls policy to the tls settings of
+// the transport.
+func (p *Plugin) SetTransportTlsPolicy(transport *http.Transport) error {
+
+	policy := p.tlsPolicy
+	if policy == nil {
+		return nil
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	tlsConfig := transport.TLSClientConfig
+
+	tlsConfig.MinVersion = policy.MinVersion
+	tlsConfig.MaxVersion = policy.MaxVersion
+	tlsConfig.CipherSuites = policy.CipherSuites
+	tlsConfig.ServerName = policy.ServerName
+
+	if len(policy.Pins) > 0 {
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return policy.VerifyPins(state)
+		}
+	}
+
+	return nil
+}
+
+// VerifyPins accepts the connection when the public key of any
+// certificate of the verified chains matches any of the pins. Without
+// verification, with ignore_ssl, only the leaf certificate is matched,
+// the rest of the certificates the server sent are unauthenticated.
+func (policy *TlsPolicy) VerifyPins(state tls.ConnectionState) error {
+
+	var certs []*x509.Certificate
+	if len(state.VerifiedChains) > 0 {
+		for _, chain := range state.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+	} else if len(state.PeerCertificates) > 0 {
+		certs = state.PeerCertificates[:1]
+	}
+
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range policy.Pins {
+			if bytes.Equal(hash[:], pin) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("no certificate of the server matches tls_pin_sha256")
+}
+
+func parseTlsVersion(name, value string) (uint16, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	normalized := strings.TrimPrefix(strings.ToUpper(value), "TLS")
+	normalized = strings.TrimPrefix(normalized, "V")
+	version, ok := tlsVersions[normalized]
+	if !ok {
+		return 0, errors.New("invalid " + name + " " + value + ", expected 1.0, 1.1, 1.2 or 1.3")
+	}
+
+	return version, nil
+}
@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTlsPolicyWithLocalServer(t *testing.T) {
+
+	_, found := enableTests["TestTlsPolicyWithLocalServer"]
+	if !found {
+		t.Skip("Skipping TestTlsPolicyWithLocalServer test")
+	}
+
+	var states []*tls.ConnectionState
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		states = append(states, r.TLS)
+	}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	serverCa := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+	spki := sha256.Sum256(ts.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(spki[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	run := func(params PluginInputParams) error {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		return Exec(context.Background(), Args{PluginInputParams: params})
+	}
+
+	valid := []PluginInputParams{
+		{CaCert: serverCa, TlsMinVersion: "1.2"},
+		{CaCert: serverCa, TlsCiphers: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		{CaCert: serverCa, TlsServerName: "example.com"},
+		{CaCert: serverCa, TlsPinSha256: otherPin + "," + pin},
+		{IgnoreSsl: true, TlsPinSha256: "sha256//" + pin},
+	}
+	for i, params := range valid {
+		if err := run(params); err != nil {
+			t.Fatalf("Exec() with settings %d returned an error: %v", i, err)
+		}
+	}
+
+	if len(states) != len(valid) {
+		t.Fatalf("Expected %d requests, got %d", len(valid), len(states))
+	}
+	if states[1].CipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Expected the tls_ciphers suite, got %s", tls.CipherSuiteName(states[1].CipherSuite))
+	}
+	if states[2].ServerName != "example.com" {
+		t.Errorf("Expected example.com as SNI, got %q", states[2].ServerName)
+	}
+
+	failing := []PluginInputParams{
+		{CaCert: serverCa, TlsMinVersion: "TLS1.3"},
+		{CaCert: serverCa, TlsServerName: "other.example.org"},
+		{CaCert: serverCa, TlsPinSha256: otherPin},
+		{IgnoreSsl: true, TlsPinSha256: otherPin},
+		{CaCert: serverCa, TlsMinVersion: "1.4"},
+		{CaCert: serverCa, TlsMinVersion: "1.3", TlsMaxVersion: "1.2"},
+		{CaCert: serverCa, TlsCiphers: "TLS_NOT_A_CIPHER"},
+		{CaCert: serverCa, TlsPinSha256: "not-a-pin"},
+	}
+	for i, params := range failing {
+		if err := run(params); err == nil {
+			t.Errorf("Expected settings %d to fail", i)
+		}
+	}
+}
+
+func TestTlsPinOutsideVerifiedChain(t *testing.T) {
+
+	_, found := enableTests["TestTlsPinOutsideVerifiedChain"]
+	if !found {
+		t.Skip("Skipping TestTlsPinOutsideVerifiedChain test")
+	}
+
+	caPem, err := os.ReadFile(clientTlsCaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caBlock, _ := pem.Decode(caPem)
+	pinned, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedSpki := sha256.Sum256(pinned.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(pinnedSpki[:])
+
+	// The server holds the key of an unrelated self-signed leaf and
+	// sends the public pinned certificate as an extra chain entry.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "attacker"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCa := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDer}))
+	leaf, _ := x509.ParseCertificate(leafDer)
+	leafSpki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	leafPin := base64.StdEncoding.EncodeToString(leafSpki[:])
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leafDer, pinned.Raw},
+		PrivateKey:  key,
+	}}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	run := func(params PluginInputParams) error {
+		params.Url = ts.URL
+		params.HttpMethod = "GET"
+		params.Quiet = true
+		return Exec(context.Background(), Args{PluginInputParams: params})
+	}
+
+	if err := run(PluginInputParams{IgnoreSsl: true, TlsPinSha256: leafPin}); err != nil {
+		t.Fatalf("Expected the leaf pin to pass, got: %v", err)
+	}
+	if err := run(PluginInputParams{IgnoreSsl: true, TlsPinSha256: pin}); err == nil {
+		t.Errorf("Expected the pin of an unverified chain certificate to fail with ignore_ssl")
+	}
+	if err := run(PluginInputParams{CaCert: leafCa, TlsPinSha256: pin}); err == nil {
+		t.Errorf("Expected the pin of a certificate outside the verified chain to fail")
+	}
+}
@@ -14,7 +14,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func writeCard(p *Plugin, path, schema string, card interface{}) {
@@ -53,7 +56,7 @@ func LogPrintln(p *Plugin, args ...interface{}) {
 		}
 	}
 
-	log.Println(append([]interface{}{"Plugin Info:"}, args...)...)
+	log.Print(p.RedactSecrets(fmt.Sprintln(append([]interface{}{"Plugin Info:"}, args...)...)))
 }
 
 func LogPrintf(p *Plugin, format string, args ...interface{}) {
@@ -63,7 +66,7 @@ func LogPrintf(p *Plugin, format string, args ...interface{}) {
 		}
 	}
 
-	log.Printf("Plugin Info: "+format, args...)
+	log.Print(p.RedactSecrets(fmt.Sprintf("Plugin Info: "+format, args...)))
 }
 
 func GetAbsolutePath(path string) (string, error) {
@@ -175,6 +178,11 @@ func EmitShCliForPluginStruct(s interface{},
 			continue
 		}
 
+		if field.Tag.Get("secret") == "true" {
+			envVars = append(envVars, processTag(envTag, RedactedSecret))
+			continue
+		}
+
 		switch value.Kind() {
 		case reflect.String:
 			envVars = append(envVars, processTag(envTag, value.String()))
@@ -182,6 +190,8 @@ func EmitShCliForPluginStruct(s interface{},
 			envVars = append(envVars, processTag(envTag, fmt.Sprintf("%d", value.Int())))
 		case reflect.Bool:
 			envVars = append(envVars, processTag(envTag, fmt.Sprintf("%t", value.Bool())))
+		case reflect.Float64:
+			envVars = append(envVars, processTag(envTag, strconv.FormatFloat(value.Float(), 'f', -1, 64)))
 		}
 	}
 
@@ -233,6 +243,90 @@ func WriteEnvToFile(key string, value interface{}) error {
 	return nil
 }
 
+// SplitSettingList splits a list valued setting. Drone passes a yaml
+// list of strings as a comma separated value, so commas separate
+// items unless the value is a json array or spans multiple lines, in
+// which case items may contain commas themselves.
+func SplitSettingList(value string) []string {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &items); err == nil {
+			return items
+		}
+	}
+
+	separator := ","
+	if strings.Contains(value, "\n") {
+		separator = "\n"
+	}
+
+	for _, item := range strings.Split(value, separator) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// ParseDurationSetting accepts a go duration such as 500ms or 2m, or a
+// bare number of seconds.
+func ParseDurationSetting(value string) (time.Duration, error) {
+
+	value = strings.TrimSpace(value)
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("negative duration %s", value)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+
+	return duration, nil
+}
+
+// DurationSeconds is a number of seconds that envconfig also reads from
+// a duration string like 500ms or 2m.
+type DurationSeconds float64
+
+func (d *DurationSeconds) Decode(value string) error {
+	duration, err := ParseDurationSetting(value)
+	if err != nil {
+		return err
+	}
+	*d = DurationSeconds(duration.Seconds())
+	return nil
+}
+
+func (d DurationSeconds) Duration() time.Duration {
+	return time.Duration(float64(d) * float64(time.Second))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 const (
 	Schema                 = "https://drone.github.io/drone-jira/card.json"
 	StdOut                 = "/dev/stdout"